@@ -0,0 +1,377 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/validator"
+)
+
+/*
+	Admin dashboard
+	===============
+		The back office of the site, for the admins among the moderators:
+
+			/admin          the version of the build, the database pool and
+			                the number of sessions
+			/admin/blogs    every blog, expired ones and drafts too, to
+			                search through and delete, extend, publish or
+			                unpublish many at once
+			/admin/users    the moderators, to make admins of them or
+			                disable them
+			/admin/stats    the page views, see analytics.go
+
+		The moderators are the name:password pairs of the -moderators flag.
+		Which of them are admins, and which are disabled, is kept in the
+		staff table, so it can be changed without a restart. The names in
+		-admins are always admins and can't be changed on the dashboard,
+		so there's always somebody who can get in:
+
+			go run ./cmd/web -moderators="munna:secret,rafi:another" -admins="munna"
+
+		Blogs are published as soon as they're written. An admin can
+		unpublish a blog, which makes a draft of it: only the dashboard
+		lists drafts, the public pages, feeds and the sitemap act as if
+		they weren't there, until it's published again.
+
+		The forms of the dashboard delete blogs and hand out the admin
+		role, so they carry the CSRF token of the session, which
+		requireCSRFToken checks (see middleware.go).
+*/
+
+// adminPageSize is the number of blogs on a page of /admin/blogs.
+const adminPageSize = 25
+
+// version is the version of the build, set with
+// -ldflags="-X main.version=v1.4.0". The VCS revision is shown as well.
+var version string
+
+// extendDays are the numbers of days the expiry of blogs can be moved.
+var extendDays = []int{7, 30, 365}
+
+// parseAdmins() turns the value of the -admins flag, a comma separated list of
+// names, into a set. Every admin must be one of the moderators.
+func parseAdmins(s string, moderators map[string]string) (map[string]bool, error) {
+	admins := map[string]bool{}
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := moderators[name]; !ok {
+			return nil, fmt.Errorf("admin %q isn't one of the -moderators", name)
+		}
+		admins[name] = true
+	}
+
+	return admins, nil
+}
+
+// isAdmin() reports whether the moderator is an admin, from -admins or the
+// staff table.
+func (app *application) isAdmin(name string) (bool, error) {
+	if app.admins[name] {
+		return true, nil
+	}
+
+	staff, err := app.staff.Get(name)
+	if err != nil {
+		return false, err
+	}
+	return staff.Role == model.RoleAdmin && !staff.Disabled, nil
+}
+
+// systemInfo is what the front page of the dashboard shows.
+type systemInfo struct {
+	Version    string
+	Revision   string
+	BuildTime  string
+	Modified   bool
+	GoVersion  string
+	Started    time.Time
+	Goroutines int
+	Sessions   int
+	DB         sql.DBStats
+}
+
+// buildInfo() fills in the version of the build, from -ldflags and from what
+// the go command recorded in the binary.
+func buildInfo(info *systemInfo) {
+	info.Version = version
+	info.GoVersion = runtime.Version()
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+
+	if info.Version == "" {
+		info.Version = build.Main.Version
+	}
+
+	for _, s := range build.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+}
+
+func (app *application) admin(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.sessions.Active()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	info := &systemInfo{
+		Started:    app.started,
+		Goroutines: runtime.NumGoroutine(),
+		Sessions:   sessions,
+		DB:         app.db.Stats(),
+	}
+	buildInfo(info)
+
+	data := app.newTemplateData(r)
+	data.System = info
+
+	app.render(w, r, http.StatusOK, "admin.html", data)
+}
+
+// adminBlogsFilter is the filter of /admin/blogs, from the query string.
+type adminBlogsFilter struct {
+	Query  string `form:"q"`
+	Status string `form:"status"`
+	Lang   string `form:"lang"`
+	Page   int    `form:"page"`
+}
+
+// URL() returns the address of /admin/blogs with the filter, on the given
+// page. The page links of the template use it too.
+func (f adminBlogsFilter) URL(page int) string {
+	v := url.Values{}
+	if f.Query != "" {
+		v.Set("q", f.Query)
+	}
+	if f.Status != "" {
+		v.Set("status", f.Status)
+	}
+	if f.Lang != "" {
+		v.Set("lang", f.Lang)
+	}
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+
+	if len(v) == 0 {
+		return "/admin/blogs"
+	}
+	return "/admin/blogs?" + v.Encode()
+}
+
+// adminBlogsForm is the form of the bulk actions of /admin/blogs. It carries
+// the filter along, so the page looks the same after the action.
+type adminBlogsForm struct {
+	IDs    []int  `form:"ids"`
+	Action string `form:"action"`
+	Days   int    `form:"days"`
+	adminBlogsFilter
+}
+
+func (app *application) adminBlogs(w http.ResponseWriter, r *http.Request) {
+	var filter adminBlogsFilter
+
+	err := app.formDecoder.Decode(&filter, r.URL.Query())
+	if err != nil || !slices.Contains([]string{"", "live", "expired", "draft"}, filter.Status) || filter.Page < 0 {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	if filter.Page == 0 {
+		filter.Page = 1
+	}
+
+	blogs, total, err := app.blogs.Search(model.BlogFilter{
+		Query:  strings.TrimSpace(filter.Query),
+		Status: filter.Status,
+		Lang:   filter.Lang,
+	}, adminPageSize, (filter.Page-1)*adminPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Blogs = blogs
+	data.Form = filter
+	data.Page = filter.Page
+	if filter.Page > 1 {
+		data.PrevPage = filter.Page - 1
+	}
+	if filter.Page*adminPageSize < total {
+		data.NextPage = filter.Page + 1
+	}
+
+	app.render(w, r, http.StatusOK, "admin_blogs.html", data)
+}
+
+func (app *application) adminBlogsPost(w http.ResponseWriter, r *http.Request) {
+	var form adminBlogsForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	loc := app.localizer(r)
+
+	switch {
+	case len(form.IDs) == 0:
+		app.sessionManager.Put(r.Context(), "flash", loc.T("flash.admin_none"))
+
+	case form.Action == "delete":
+		err = app.blogs.Delete(form.IDs)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "flash", loc.T("flash.admin_deleted", len(form.IDs)))
+
+	case form.Action == "extend" && validator.PermittedInt(form.Days, extendDays...):
+		err = app.blogs.Extend(form.IDs, form.Days)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		// Blogs which had expired are back, and can be related posts
+		// again.
+		for _, id := range form.IDs {
+			app.queueRelated(id)
+		}
+		app.sessionManager.Put(r.Context(), "flash", loc.T("flash.admin_extended", len(form.IDs), form.Days))
+
+	case form.Action == "publish":
+		err = app.blogs.SetPublished(form.IDs, true)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		// Like the extended blogs, published drafts can be related posts
+		// again.
+		for _, id := range form.IDs {
+			app.queueRelated(id)
+		}
+		app.sessionManager.Put(r.Context(), "flash", loc.T("flash.admin_published", len(form.IDs)))
+
+	case form.Action == "unpublish":
+		err = app.blogs.SetPublished(form.IDs, false)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "flash", loc.T("flash.admin_unpublished", len(form.IDs)))
+
+	default:
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, form.URL(form.Page), http.StatusSeeOther)
+}
+
+// staffMember is a moderator on /admin/users. Owners are the admins from
+// -admins, who can't be changed here, and nobody can change themselves.
+type staffMember struct {
+	model.Staff
+	Owner bool
+	Self  bool
+}
+
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	staff, err := app.staff.All()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	names := make([]string, 0, len(app.moderators))
+	for name := range app.moderators {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	members := []staffMember{}
+	for _, name := range names {
+		m := staffMember{
+			Staff: model.Staff{Name: name, Role: model.RoleModerator},
+			Owner: app.admins[name],
+			Self:  name == app.moderator(r),
+		}
+		if s, ok := staff[name]; ok {
+			m.Staff = *s
+		}
+		if m.Owner {
+			m.Role, m.Disabled = model.RoleAdmin, false
+		}
+		members = append(members, m)
+	}
+
+	data := app.newTemplateData(r)
+	data.Staff = members
+
+	app.render(w, r, http.StatusOK, "admin_users.html", data)
+}
+
+// adminUserForm is the form of one moderator on /admin/users.
+type adminUserForm struct {
+	Role     string `form:"role"`
+	Disabled bool   `form:"disabled"`
+}
+
+func (app *application) adminUserPost(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	if _, ok := app.moderators[name]; !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	// The form doesn't have these, but a request could be made by hand.
+	if app.admins[name] || name == app.moderator(r) {
+		app.clientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	var form adminUserForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || (form.Role != model.RoleModerator && form.Role != model.RoleAdmin) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	err = app.staff.Set(name, form.Role, form.Disabled)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T("flash.admin_user_saved", name))
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
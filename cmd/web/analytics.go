@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/validator"
+)
+
+/*
+	Analytics
+	=========
+		We count which pages get read on the server, without any script or
+		cookie of a third party (the CSP of secureHeaders wouldn't let them
+		load anyway):
+
+			- countView is the middleware of the public pages. A successful
+			  GET (200, or a 304 for a page the browser has) is a view,
+			  unless the User-Agent says it's a bot. It only wraps routes
+			  of the router, and their handlers answer paths which don't
+			  name a page with a 404, so made up paths are never stored.
+			  A path which is too long for the column is cut short.
+			- The visitor is a hash of a random salt, the IP address and the
+			  User-Agent. The salt is made again every day (UTC) and never
+			  saved, so yesterday's hashes can't be worked out again, and a
+			  visitor is only the same visitor for one day. Since it's only
+			  kept in memory, a restart makes a new salt in the middle of
+			  the day: a visitor who comes back after it counts as a new
+			  visitor of that day, and can add the reactions they already
+			  added once more (see reactions.go).
+			- Only the host of the Referer is kept, and only when it's
+			  another site, so paths with private tokens are never stored.
+			  Like the path, it's cut short when it's too long.
+			- The views go through a channel to viewWriter(), which writes
+			  them in batches, so a page view never waits for the database.
+			  The views of the last few seconds are lost when the server
+			  stops.
+
+		/admin/stats (admins only, see admin.go) shows the views of every
+		day, the blogs read most and where the readers came from.
+
+		Note:
+			Pages served from a CDN or browser cache without asking us aren't
+			counted. Behind a reverse proxy every visitor has the address of
+			the proxy, so visitors are only told apart by their User-Agent.
+*/
+
+const (
+	// viewQueueSize is how many views can wait for viewWriter(). Views which
+	// don't fit are dropped, a burst of traffic shouldn't slow pages down.
+	viewQueueSize = 1000
+
+	// A batch is written when it has viewBatchSize views, or every
+	// viewFlushInterval, whichever comes first.
+	viewBatchSize     = 100
+	viewFlushInterval = 10 * time.Second
+
+	// maxViewPath and maxViewReferrer are the lengths of the path and
+	// referrer columns of page_views, in characters.
+	maxViewPath     = 255
+	maxViewReferrer = 255
+)
+
+// bots matches the User-Agents of crawlers, feed fetchers, link previews and
+// scripts, which aren't readers.
+var bots = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|archiver|fetch|preview|facebookexternalhit|monitor|lighthouse|headless|curl|wget|python|go-http-client|java/|okhttp|httpclient|feed`)
+
+// isBot() reports whether a request was made by a bot. Browsers always send a
+// User-Agent, so no User-Agent is a bot as well.
+func isBot(userAgent string) bool {
+	return userAgent == "" || bots.MatchString(userAgent)
+}
+
+// visitorSalt is the random salt of the visitor hashes of one day.
+type visitorSalt struct {
+	mu   sync.Mutex
+	day  string
+	salt []byte
+}
+
+// get() returns the salt of day. A new salt is made the first time it's asked
+// for a day.
+func (s *visitorSalt) get(day string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.day != day {
+		salt := make([]byte, 32)
+		// Without randomness the hashes could be worked out again, so
+		// like csrfToken() we don't go on.
+		if _, err := rand.Read(salt); err != nil {
+			panic(err)
+		}
+		s.day, s.salt = day, salt
+	}
+	return s.salt
+}
+
+// hash() returns the visitor hash of the IP address and User-Agent on day.
+func (s *visitorSalt) hash(day, ip, userAgent string) string {
+	h := sha256.New()
+	h.Write(s.get(day))
+	h.Write([]byte(ip))
+	h.Write([]byte{0})
+	h.Write([]byte(userAgent))
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// referrerHost() returns the host of the Referer of a request, or "" when there
+// isn't one or it's our own site.
+func referrerHost(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == strings.ToLower(hostname(r.Host)) {
+		return ""
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+// hostname() returns host without its port.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// statusWriter remembers the status of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap() lets http.ResponseController find the writer underneath.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countView is the middleware which counts the views of a page.
+func (app *application) countView(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.views == nil || r.Method != http.MethodGet || isBot(r.UserAgent()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		view := &model.PageView{Path: viewPath(r.URL.Path)}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		ctx := context.WithValue(r.Context(), viewContextKey, view)
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		if sw.status != http.StatusOK && sw.status != http.StatusNotModified {
+			return
+		}
+
+		now := time.Now().UTC()
+		view.Created = now
+		view.Visitor = app.visitorSalt.hash(now.Format(time.DateOnly), hostname(r.RemoteAddr), r.UserAgent())
+		view.Referrer = viewReferrer(referrerHost(r))
+
+		select {
+		case app.views <- *view:
+		default:
+			app.errorLog.Print("Page view queue is full, dropping a view")
+		}
+	})
+}
+
+// viewPath() returns the path as it's stored: valid UTF-8, and at most
+// maxViewPath characters.
+func viewPath(path string) string {
+	return truncate(strings.ToValidUTF8(path, "\uFFFD"), maxViewPath)
+}
+
+// viewReferrer() returns the host of the referrer as it's stored, like
+// viewPath(): valid UTF-8, and at most maxViewReferrer characters.
+func viewReferrer(host string) string {
+	return truncate(strings.ToValidUTF8(host, "\uFFFD"), maxViewReferrer)
+}
+
+// truncate() cuts s short to at most n characters.
+func truncate(s string, n int) string {
+	if validator.MaxChars(s, n) {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// setViewBlog() records that the page of the request shows the blog, so the
+// view counts for it.
+func setViewBlog(r *http.Request, blogID int) {
+	if view, ok := r.Context().Value(viewContextKey).(*model.PageView); ok {
+		view.BlogID = blogID
+	}
+}
+
+// viewWriter() writes the views sent to app.views in batches, for as long as
+// the server runs.
+func (app *application) viewWriter() {
+	ticker := time.NewTicker(viewFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.PageView, 0, viewBatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := app.pageViews.Insert(batch); err != nil {
+			app.errorLog.Printf("Writing %d page views: %s", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case view := <-app.views:
+			batch = append(batch, view)
+			if len(batch) >= viewBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+/*
+	The dashboard
+	=============
+		The charts are SVG drawn by the template, the CSP doesn't allow
+		inline styles or scripts, but the attributes of SVG shapes are
+		fine. Every day of the period has a bar, days without views too.
+*/
+
+// statsPeriods are the numbers of days the dashboard can show.
+var statsPeriods = []int{7, 30, 90}
+
+// statsTopSize is how many blogs and referrers the dashboard lists.
+const statsTopSize = 10
+
+// The size of the charts, in SVG units.
+const (
+	chartWidth  = 800
+	chartHeight = 200
+)
+
+// svgChart is a bar chart of views, with one bar for every day.
+type svgChart struct {
+	Width, Height int
+	Bars          []bar
+}
+
+// bar is one bar of a chart.
+type bar struct {
+	X, Y, Width, Height int
+	Day                 time.Time
+	Views               int
+	Visitors            int
+}
+
+// blogStats are the numbers of one blog on the dashboard.
+type blogStats struct {
+	model.BlogViews
+	Chart *svgChart
+}
+
+// siteStats is everything the dashboard shows.
+type siteStats struct {
+	Days      int
+	Periods   []int
+	Views     int
+	Visitors  int
+	Chart     *svgChart
+	Blogs     []blogStats
+	Referrers []model.ReferrerViews
+}
+
+// chart() turns the daily views since the first day into one bar for every
+// day, scaled to fit width × height.
+func chart(first time.Time, days int, daily []model.DailyViews, width, height int) *svgChart {
+	byDay := map[string]model.DailyViews{}
+	highest := 1
+	for _, d := range daily {
+		byDay[d.Day.Format(time.DateOnly)] = d
+		highest = max(highest, d.Views)
+	}
+
+	bars := make([]bar, days)
+	step := width / days
+
+	for i := range bars {
+		day := first.AddDate(0, 0, i)
+		d := byDay[day.Format(time.DateOnly)]
+		h := d.Views * height / highest
+
+		bars[i] = bar{
+			X:        i * step,
+			Y:        height - h,
+			Width:    max(step-1, 1),
+			Height:   h,
+			Day:      day,
+			Views:    d.Views,
+			Visitors: d.Visitors,
+		}
+	}
+
+	return &svgChart{Width: width, Height: height, Bars: bars}
+}
+
+func (app *application) adminStats(w http.ResponseWriter, r *http.Request) {
+	// The period comes from the query string (/admin/stats?days=7), a
+	// missing one is 30 days.
+	days := 30
+	if d := r.URL.Query().Get("days"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || !validator.PermittedInt(n, statsPeriods...) {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	// The period starts at midnight (UTC), days-1 days ago, so today is
+	// the last day of it.
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	first := today.AddDate(0, 0, -(days - 1))
+
+	daily, err := app.pageViews.Daily(first, 0)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	stats := &siteStats{
+		Days:    days,
+		Periods: statsPeriods,
+		Chart:   chart(first, days, daily, chartWidth, chartHeight),
+	}
+	for _, d := range daily {
+		stats.Views += d.Views
+		stats.Visitors += d.Visitors
+	}
+
+	blogs, err := app.pageViews.TopBlogs(first, statsTopSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, b := range blogs {
+		daily, err := app.pageViews.Daily(first, b.BlogID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		stats.Blogs = append(stats.Blogs, blogStats{
+			BlogViews: b,
+			Chart:     chart(first, days, daily, chartWidth/4, chartHeight/5),
+		})
+	}
+
+	stats.Referrers, err = app.pageViews.TopReferrers(first, statsTopSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Stats = stats
+
+	app.render(w, r, http.StatusOK, "admin_stats.html", data)
+}
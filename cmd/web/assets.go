@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+/*
+	Fingerprinted static files
+	==========================
+		When the application starts we hash every file in ui/static and give
+		it a second name with the hash in it, like css/main.css ->
+		css/main.3f2a9c1b.css. Templates link the hashed name through the
+		static template function: {{static "css/main.css"}}.
+
+		Because the name changes whenever the content changes, browsers and
+		CDNs can keep a hashed file forever (Cache-Control: immutable) and
+		still never show an old version after a deploy.
+
+		Note:
+			The .br and .gz copies of a file are not given names of their
+			own, serveStatic() finds them next to the original file.
+*/
+
+// staticAssets maps the names of the files in ui/static to their hashed
+// names and back again.
+type staticAssets struct {
+	hashed   map[string]string // "css/main.css" -> "css/main.3f2a9c1b.css"
+	original map[string]string // "css/main.3f2a9c1b.css" -> "css/main.css"
+	// base is the -static-url the hashed files were copied to, or "" to
+	// serve them from /static/ ourselves.
+	base string
+}
+
+// newStaticAssets() hashes every file in fsys.
+func newStaticAssets(fsys fs.FS) (*staticAssets, error) {
+	assets := &staticAssets{
+		hashed:   map[string]string{},
+		original: map[string]string{},
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		switch path.Ext(name) {
+		case ".br", ".gz":
+			return nil
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+
+		ext := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(h.Sum(nil)[:4]) + ext
+
+		assets.hashed[name] = hashedName
+		assets.original[hashedName] = name
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+// URL() returns the URL of a static file, using its hashed name when it has
+// one. It's the static template function.
+func (a *staticAssets) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+
+	if hashedName, ok := a.hashed[name]; ok {
+		if a.base != "" {
+			return a.base + "/" + hashedName
+		}
+		return "/static/" + hashedName
+	}
+	return "/static/" + name
+}
+
+// Original() returns the real name of a hashed file name, and whether it was
+// a hashed name at all.
+func (a *staticAssets) Original(hashedName string) (string, bool) {
+	name, ok := a.original[strings.TrimPrefix(hashedName, "/")]
+	return name, ok
+}
+
+// immutable is a middleware for the static file server. Requests for a hashed
+// file name are rewritten to the real file and marked as cacheable forever.
+func (a *staticAssets) immutable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, ok := a.Original(r.URL.Path); ok {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+			// Make a shallow copy of the request with the real path,
+			// like http.StripPrefix() does, so we don't change the
+			// request the other middleware see.
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = "/" + name
+			r2.URL.RawPath = ""
+
+			next.ServeHTTP(w, r2)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/storage"
+)
+
+/*
+	Commands
+	========
+		The binary also runs a few maintenance commands instead of the
+		server. They come after the usual flags, which set up the storage
+		the same way the server does:
+
+			go run ./cmd/web -s3-bucket="storybook" ... media migrate -from=disk -to=s3
+			go run ./cmd/web -s3-bucket="storybook" ... media push-static
+			go run ./cmd/web -dsn="..." related rebuild
+			go run ./cmd/web -dsn="..." blogs summarize
+
+		media migrate
+		-------------
+			copies every file from one storage to the other. Files which
+			are in the target already are skipped, so a migration which
+			stopped halfway can be run again. With -delete the files are
+			removed from the source as well, with -dry-run nothing is
+			copied and the files are only listed.
+
+		media push-static
+		-----------------
+			copies the hashed static files of every theme to static/ in the
+			storage (S3 by default), so they can be served from there with
+			-static-url. Everybody must be able to read static/, with a
+			bucket policy or through a CDN in front of the bucket:
+
+				-static-url="https://storybook.s3.amazonaws.com/static"
+
+			Run it on every deploy before starting the new servers, the
+			pages of the new version link files which aren't there yet.
+
+		related rebuild
+		---------------
+			works out the related posts of every blog again, see related.go.
+			The server does this by itself when it starts, the command is
+			for changing -related-posts or the scoring without a restart.
+
+		blogs summarize
+		---------------
+			works out the word count, reading time and excerpt of every blog
+			again (see internal/summary), for blogs written before they were
+			saved and after changing how they're worked out.
+*/
+
+// runCommand() runs the command in args, the arguments left after the flags.
+func runCommand(cfg config, args []string, infoLog *log.Logger) error {
+	if len(args) >= 2 && args[0] == "media" {
+		switch args[1] {
+		case "migrate":
+			return mediaMigrate(cfg, args[2:], infoLog)
+		case "push-static":
+			return pushStatic(cfg, args[2:], infoLog)
+		}
+	}
+
+	if len(args) == 2 && args[0] == "related" && args[1] == "rebuild" {
+		return relatedRebuild(cfg, infoLog)
+	}
+
+	if len(args) == 2 && args[0] == "blogs" && args[1] == "summarize" {
+		return blogsSummarize(cfg, infoLog)
+	}
+
+	return fmt.Errorf("unknown command %q, want \"media migrate\", \"media push-static\", \"related rebuild\" or \"blogs summarize\"", strings.Join(args, " "))
+}
+
+// storedKeys() returns the keys of every file in store.
+func storedKeys(ctx context.Context, store storage.Storage) (map[string]bool, error) {
+	keys := map[string]bool{}
+	err := store.Walk(ctx, func(key string) error {
+		keys[key] = true
+		return nil
+	})
+	return keys, err
+}
+
+func mediaMigrate(cfg config, args []string, infoLog *log.Logger) error {
+	flags := flag.NewFlagSet("media migrate", flag.ContinueOnError)
+	from := flags.String("from", "disk", "Storage to copy the files from: disk or s3")
+	to := flags.String("to", "s3", "Storage to copy the files to: disk or s3")
+	remove := flags.Bool("delete", false, "Delete the files from the source once they're copied")
+	dryRun := flags.Bool("dry-run", false, "Only list the files which would be copied")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == *to {
+		return errors.New("-from and -to are the same storage")
+	}
+
+	src, err := newStorage(cfg, *from)
+	if err != nil {
+		return err
+	}
+	dst, err := newStorage(cfg, *to)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	// Read both listings first. Copying (and deleting) while walking the
+	// source would change what the walk sees.
+	have, err := storedKeys(ctx, dst)
+	if err != nil {
+		return fmt.Errorf("listing %s: %w", *to, err)
+	}
+	keys, err := storedKeys(ctx, src)
+	if err != nil {
+		return fmt.Errorf("listing %s: %w", *from, err)
+	}
+
+	var copied, skipped int
+
+	for key := range keys {
+		switch {
+		case have[key]:
+			skipped++
+		case *dryRun:
+			infoLog.Printf("Would copy %s", key)
+			copied++
+			continue
+		default:
+			if err := copyFile(ctx, src, dst, key); err != nil {
+				return fmt.Errorf("copying %s: %w", key, err)
+			}
+			copied++
+		}
+
+		if *remove && !*dryRun {
+			if err := src.Delete(ctx, key); err != nil {
+				return fmt.Errorf("deleting %s: %w", key, err)
+			}
+		}
+	}
+
+	infoLog.Printf("Copied %d files from %s to %s, %d were there already", copied, *from, *to, skipped)
+	return nil
+}
+
+// copyFile() copies the file of key from src to dst.
+func copyFile(ctx context.Context, src, dst storage.Storage, key string) error {
+	obj, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	return dst.Put(ctx, key, obj.Body, obj.Size, obj.ContentType)
+}
+
+func pushStatic(cfg config, args []string, infoLog *log.Logger) error {
+	flags := flag.NewFlagSet("media push-static", flag.ContinueOnError)
+	to := flags.String("to", "s3", "Storage to copy the static files to: disk or s3")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Only the hashed names are safe to serve with far-future caching, and
+	// there are none in development mode.
+	if cfg.dev {
+		return errors.New("media push-static can't be used with -dev")
+	}
+
+	siteThemes, err := parseSiteThemes(cfg.siteThemes)
+	if err != nil {
+		return err
+	}
+	themes, err := loadThemes(cfg, uiFiles(cfg), siteThemes)
+	if err != nil {
+		return err
+	}
+
+	dst, err := newStorage(cfg, *to)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	have, err := storedKeys(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	var copied int
+
+	// A file which is the same in two themes has the same hashed name, so
+	// the themes can share static/.
+	for _, t := range themes {
+		for name, hashedName := range t.assets.hashed {
+			key := "static/" + hashedName
+			if have[key] {
+				continue
+			}
+
+			if err := putStatic(ctx, dst, t.static, name, key); err != nil {
+				return fmt.Errorf("theme %s: %s: %w", t.name, name, err)
+			}
+			have[key] = true
+			copied++
+		}
+	}
+
+	infoLog.Printf("Copied %d static files to %s", copied, *to)
+	return nil
+}
+
+// putStatic() copies the file name of the static file system to key in dst.
+func putStatic(ctx context.Context, dst storage.Storage, static fs.FS, name, key string) error {
+	info, err := fs.Stat(static, name)
+	if err != nil {
+		return err
+	}
+
+	f, err := static.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return dst.Put(ctx, key, f, info.Size(), mime.TypeByExtension(path.Ext(name)))
+}
+
+func relatedRebuild(cfg config, infoLog *log.Logger) error {
+	if cfg.relatedPosts < 1 {
+		return errors.New("related rebuild needs -related-posts of 1 or more")
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = rebuildRelated(&model.RelatedModel{DB: db}, cfg.relatedPosts)
+	if err != nil {
+		return err
+	}
+
+	infoLog.Print("Rebuilt the related posts of every blog")
+	return nil
+}
+
+func blogsSummarize(cfg config, infoLog *log.Logger) error {
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := (&model.BlogModel{DB: db}).Resummarize()
+	if err != nil {
+		return err
+	}
+
+	infoLog.Printf("Summarized %d blogs", n)
+	return nil
+}
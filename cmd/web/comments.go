@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/spam"
+	"github.com/munnaMia/Story-Book/internal/validator"
+)
+
+/*
+	Comments and moderation
+	=======================
+		The comment form is at the bottom of every blog page and posts to
+		/blog/view/:id/comments. A new comment is pending: nobody sees it
+		until a moderator approves it in the queue at /moderation, where it
+		can also be rejected or marked as spam.
+
+		Translations share the comments of their blog, so the form always
+		posts to the canonical blog and the reader is sent back to the page
+		they wrote the comment on.
+*/
+
+// moderationPageSize is the number of pending comments the queue shows at once.
+const moderationPageSize = 50
+
+// commentForm is the form of the comment box on the blog page. ParentID is the
+// comment being replied to, or 0 for a new thread.
+type commentForm struct {
+	ParentID            int    `form:"parent_id"`
+	Name                string `form:"name"`
+	Content             string `form:"content"`
+	validator.Validator `form:"-"`
+	antispam
+}
+
+// moderateForm is the form of the buttons next to a comment in the queue.
+type moderateForm struct {
+	Status string `form:"status"`
+}
+
+// parseModerators() turns the value of the -moderators flag, like
+// "munna:secret,rafi:another-secret", into a map of names to passwords.
+func parseModerators(s string) (map[string]string, error) {
+	moderators := map[string]string{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, password, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || password == "" {
+			return nil, fmt.Errorf("invalid moderator %q, want name:password", pair)
+		}
+		moderators[name] = password
+	}
+
+	return moderators, nil
+}
+
+// moderator() returns the name of the logged in moderator, set by the
+// requireModerator middleware.
+func (app *application) moderator(r *http.Request) string {
+	name, _ := r.Context().Value(moderatorContextKey).(string)
+	return name
+}
+
+func (app *application) blogCommentPost(w http.ResponseWriter, r *http.Request) {
+	blog := app.blogFromParam(w, r)
+	if blog == nil {
+		return
+	}
+
+	var form commentForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.T = app.localizer(r).T
+	form.Name = strings.TrimSpace(form.Name)
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "validation.blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "validation.max_chars", 100)
+	form.CheckField(validator.NotBlank(form.Content), "content", "validation.blank")
+	form.CheckField(validator.MaxChars(form.Content, 2000), "content", "validation.max_chars", 2000)
+
+	// The spam filter decides whether the comment is published straight
+	// away, waits for a moderator, or is saved as spam.
+	status := model.CommentPending
+	if form.Valid() {
+		switch app.checkSpam(r, form.antispam, form.Name, form.Content).Verdict {
+		case spam.Approve:
+			status = model.CommentApproved
+		case spam.Reject:
+			status = model.CommentSpam
+		}
+	}
+
+	if form.Valid() {
+		_, err = app.comments.Insert(blog.ID, form.ParentID, form.Name, form.Content, status)
+		switch {
+		case errors.Is(err, model.ErrNoRecord):
+			// The comment being replied to doesn't exist, isn't on this
+			// blog or isn't approved.
+			form.AddFieldError("content", "validation.reply")
+		case err != nil:
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.showBlog(w, r, http.StatusUnprocessableEntity, blog, nil, form)
+		return
+	}
+
+	// Spam gets the same message as a queued comment, there's no need to
+	// tell a spammer they were caught.
+	flash := "flash.comment_pending"
+	if status == model.CommentApproved {
+		flash = "flash.comment_published"
+	}
+	app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T(flash))
+
+	back := localPath(r.Referer(), fmt.Sprintf("/blog/view/%d", blog.ID))
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+func (app *application) moderation(w http.ResponseWriter, r *http.Request) {
+	comments, err := app.comments.Pending(moderationPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Comments = comments
+
+	app.render(w, r, http.StatusOK, "moderation.html", data)
+}
+
+func (app *application) moderationPost(w http.ResponseWriter, r *http.Request) {
+	param := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(param.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	var form moderateForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	switch form.Status {
+	case model.CommentApproved, model.CommentRejected, model.CommentSpam:
+	default:
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	comment, err := app.comments.Get(id)
+	if err != nil {
+		if errors.Is(err, model.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Only a pending comment can be moderated. A second click (or a second
+	// moderator) mustn't teach the spam filter the same comment again.
+	err = app.comments.Moderate(id, form.Status, app.moderator(r))
+	if errors.Is(err, model.ErrModerated) {
+		app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T("flash.comment_moderated"))
+		http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Teach the spam filter with the decision. A rejected comment isn't
+	// necessarily spam (it may just be rude), so it's not learned from.
+	if form.Status != model.CommentRejected {
+		text := comment.Name + "\n" + comment.Content
+		err = app.spam.Train(spam.Submission{Text: text}, form.Status == model.CommentSpam)
+		if err != nil {
+			app.errorLog.Print(err)
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T("flash.comment_"+form.Status))
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
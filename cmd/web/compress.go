@@ -0,0 +1,375 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+/*
+	Response compression
+	====================
+		The compress middleware gzip or brotli encodes responses for clients
+		that ask for it in the Accept-Encoding header.
+
+		The first compressMinSize bytes of every response are held back in a
+		buffer. Only once we have that much do we know the response is worth
+		compressing; anything smaller is written out as it is, because the
+		encoding overhead would make it bigger, not smaller.
+
+		Note:
+			Responses which already have a Content-Encoding (like the
+			pre-compressed static files below) or a Content-Type which is
+			compressed already (images, fonts, archives...) are passed
+			straight through.
+
+		A HEAD request gets the same Content-Encoding, ETag and Vary as a
+		GET of the same URL, but nothing is encoded: its body is never
+		sent, so it goes without the Content-Length of the compressed body.
+		Handlers like http.ServeContent() don't write a body for HEAD at
+		all, so the size is taken from their Content-Length instead.
+*/
+
+// compressMinSize is the smallest response body we bother compressing.
+const compressMinSize = 1024
+
+// Encoders are fairly expensive to create, so we keep the used ones in a pool.
+var (
+	gzipPool = sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}
+	brotliPool = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}}
+)
+
+// acceptedEncodings() parses an Accept-Encoding header and returns the
+// encodings we support ("br" and "gzip"), best first. When the client likes
+// both the same, brotli wins because it compresses text better.
+func acceptedEncodings(header string) []string {
+	weights := map[string]float64{}
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+
+		switch name {
+		case "br", "gzip":
+			weights[name] = q
+		case "*":
+			for _, enc := range []string{"br", "gzip"} {
+				if _, ok := weights[enc]; !ok {
+					weights[enc] = q
+				}
+			}
+		}
+	}
+
+	encodings := []string{}
+	for _, enc := range []string{"br", "gzip"} {
+		if weights[enc] > 0 {
+			encodings = append(encodings, enc)
+		}
+	}
+
+	sort.SliceStable(encodings, func(i, j int) bool {
+		return weights[encodings[i]] > weights[encodings[j]]
+	})
+
+	return encodings
+}
+
+// compressible() reports whether a Content-Type is worth compressing.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "xml"):
+		return true
+	case mediaType == "application/javascript":
+		return true
+	}
+
+	return false
+}
+
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response changes with the Accept-Encoding header, so caches
+		// must keep a separate copy for each value.
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encodings := acceptedEncodings(r.Header.Get("Accept-Encoding"))
+		if len(encodings) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encodings[0], head: r.Method == http.MethodHead}
+		defer func() {
+			if err := cw.Close(); err != nil {
+				app.errorLog.Output(2, err.Error())
+			}
+		}()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter wraps a http.ResponseWriter, buffers the start of the body
+// and then decides whether to send the rest through an encoder or not.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	encoder  io.WriteCloser
+	head     bool // the request is a HEAD, see Response compression
+	discard  bool // the body of a compressed HEAD response is dropped
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	// Informational responses (like 103 Early Hints) go straight out.
+	if status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if cw.decided {
+		if cw.discard {
+			return len(b), nil
+		}
+		if cw.encoder != nil {
+			return cw.encoder.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= compressMinSize {
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// decide() looks at the status, headers and buffered body, picks between
+// compressing or passing through, writes the header and flushes the buffer.
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	h := cw.Header()
+
+	// Set the Content-Type now, while we still have the plain body to sniff.
+	// Otherwise net/http would sniff the compressed bytes instead.
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if cw.shouldCompress() {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		// The compressed bytes aren't the bytes the strong ETag was made
+		// from, so like most web servers we turn it into a weak one.
+		if tag := h.Get("ETag"); strings.HasPrefix(tag, `"`) {
+			h.Set("ETag", "W/"+tag)
+		}
+
+		switch {
+		case cw.head:
+			cw.discard = true
+		case cw.encoding == "br":
+			bw := brotliPool.Get().(*brotli.Writer)
+			bw.Reset(cw.ResponseWriter)
+			cw.encoder = pooledWriter{bw, &brotliPool}
+		case cw.encoding == "gzip":
+			gw := gzipPool.Get().(*gzip.Writer)
+			gw.Reset(cw.ResponseWriter)
+			cw.encoder = pooledWriter{gw, &gzipPool}
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 || cw.discard {
+		return nil
+	}
+
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) shouldCompress() bool {
+	h := cw.Header()
+
+	size := int64(len(cw.buf))
+	if cw.head {
+		if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n > size {
+			size = n
+		}
+	}
+	if size < compressMinSize {
+		return false
+	}
+
+	switch cw.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	return compressible(h.Get("Content-Type"))
+}
+
+// Close() flushes anything still buffered and finishes the encoded stream.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		// Nothing was written at all, leave the response to net/http.
+		if cw.status == 0 {
+			return nil
+		}
+		if err := cw.decide(); err != nil {
+			return err
+		}
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+// Flush() lets handlers stream responses through the middleware.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.decide()
+	}
+
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap() is used by http.ResponseController to reach the real writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// encoder is what both *gzip.Writer and *brotli.Writer look like.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// pooledWriter puts its encoder back in the pool once it's closed.
+type pooledWriter struct {
+	encoder
+	pool *sync.Pool
+}
+
+func (pw pooledWriter) Close() error {
+	err := pw.encoder.Close()
+	pw.encoder.Reset(io.Discard)
+	pw.pool.Put(pw.encoder)
+	return err
+}
+
+/*
+	Pre-compressed static files
+	===========================
+		If ui/static holds a main.css.br or main.css.gz next to main.css we
+		serve that instead of compressing main.css again on every request.
+		The files can be made at build time, EX --> brotli -k main.css
+*/
+
+var precompressedExt = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// serveStatic() returns a handler for the static files in root which prefers
+// pre-compressed siblings of a file when the client accepts them.
+func serveStatic(root http.FileSystem) http.Handler {
+	fileserver := http.FileServer(root)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+
+		for _, enc := range acceptedEncodings(r.Header.Get("Accept-Encoding")) {
+			f, err := root.Open(name + precompressedExt[enc])
+			if err != nil {
+				continue
+			}
+
+			info, err := f.Stat()
+			if err != nil || info.IsDir() {
+				f.Close()
+				continue
+			}
+
+			if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+				w.Header().Set("Content-Type", ctype)
+			}
+			w.Header().Set("Content-Encoding", enc)
+
+			http.ServeContent(w, r, name, info.ModTime(), f)
+			f.Close()
+			return
+		}
+
+		fileserver.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,19 @@
+package main
+
+// contextKey is our own type for the keys of the values we store in the request
+// context. Using a custom type means our keys can't clash with the keys of
+// any third-party package which also uses the request context.
+type contextKey string
+
+// localizerContextKey is the key for the i18n.Localizer of the request, which
+// the negotiateLocale middleware stores in the request context.
+const localizerContextKey = contextKey("localizer")
+
+// moderatorContextKey is the key for the name of the moderator who is logged
+// in, which the requireModerator middleware stores in the request context.
+const moderatorContextKey = contextKey("moderator")
+
+// viewContextKey is the key for the *model.PageView of the request, which the
+// countView middleware stores in the request context and the handlers fill in
+// with the blog being read.
+const viewContextKey = contextKey("view")
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+)
+
+/*
+	Debug page
+	==========
+		In development mode (-dev) serverError() shows this page instead of
+		the plain "Internal Server Error". It's parsed from a string and not
+		from ui/html, so it still works when the error is a broken template.
+
+		Note:
+			The page only links our own stylesheet. Inline <style> and
+			<script> would be blocked by the Content-Security-Policy.
+*/
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <link rel="stylesheet" href="/static/css/main.css">
+    <title>500 Internal Server Error - StoryBook</title>
+</head>
+<body>
+    <header>
+        <h1>500 Internal Server Error</h1>
+    </header>
+    <main>
+        <h2>Error</h2>
+        <pre><code>{{.Error}}</code></pre>
+        <h2>Stack trace</h2>
+        <pre><code>{{.Stack}}</code></pre>
+    </main>
+    <footer>Development mode, this page is never shown in production.</footer>
+</body>
+</html>
+`))
+
+// debugPage() writes the debug page for err with the given stack trace.
+func (app *application) debugPage(w http.ResponseWriter, err error, stack []byte) {
+	data := struct {
+		Error string
+		Stack string
+	}{
+		Error: err.Error(),
+		Stack: string(stack),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusInternalServerError)
+
+	if err := debugTemplate.Execute(w, data); err != nil {
+		app.errorLog.Output(2, err.Error())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/munnaMia/Story-Book/internal/model"
+)
+
+// feedPageSize is the number of blogs in each page of the JSON feed.
+const feedPageSize = 10
+
+/*
+	JSON Feed
+	=========
+		JSON Feed 1.1 (https://www.jsonfeed.org/version/1.1/) is a syndication
+		format like RSS and Atom but written in JSON. The structs below only hold
+		the fields we fill in; the `omitempty` tags keep the optional ones out of
+		the output when we have nothing to put there.
+*/
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	NextURL     string           `json:"next_url,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Image         string           `json:"image,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+// newJSONFeedItem converts a blog into a JSON feed item. The content is stored
+// as plain text, so for content_html we escape it and wrap it in a <pre> block
+// the same way view.html shows it.
+func (app *application) newJSONFeedItem(r *http.Request, blog *model.Blog) jsonFeedItem {
+	url := app.absoluteURL(r, fmt.Sprintf("/blog/view/%d", blog.ID))
+
+	// Feed readers show the image of an item as its main picture, the
+	// cover of the blog is just that.
+	image := ""
+	if blog.Cover != nil {
+		image = app.absoluteURL(r, mediaURL(blog.Cover, shareImageWidth))
+	}
+
+	return jsonFeedItem{
+		ID:            url,
+		URL:           url,
+		Title:         blog.Title,
+		ContentHTML:   "<pre>" + template.HTMLEscapeString(blog.Content) + "</pre>",
+		ContentText:   blog.Content,
+		Summary:       blog.Excerpt,
+		DatePublished: blog.Created.UTC().Format(time.RFC3339),
+		// Blogs can't be edited yet, so the modified date is the created date.
+		DateModified: blog.Created.UTC().Format(time.RFC3339),
+		Image:        image,
+		Authors:      []jsonFeedAuthor{{Name: app.config.author}},
+		Tags:         blog.Tags,
+	}
+}
+
+func (app *application) feedJSON(w http.ResponseWriter, r *http.Request) {
+	// The page number comes from the query string (/feed.json?page=2). A
+	// missing page means the first one.
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			app.notFound(w, r)
+			return
+		}
+		page = n
+	}
+
+	// Fetch one more blog than we need, so we know if there is a next page
+	// without running a separate COUNT query.
+	blogs, err := app.blogs.Page(feedPageSize+1, (page-1)*feedPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       "StoryBook",
+		HomePageURL: app.absoluteURL(r, "/"),
+		FeedURL:     app.absoluteURL(r, "/feed.json"),
+		Language:    "en",
+		Authors:     []jsonFeedAuthor{{Name: app.config.author}},
+		Items:       []jsonFeedItem{},
+	}
+
+	if len(blogs) > feedPageSize {
+		blogs = blogs[:feedPageSize]
+		feed.NextURL = app.absoluteURL(r, fmt.Sprintf("/feed.json?page=%d", page+1))
+	}
+
+	// Get the tags of all the blogs with one query.
+	ids := make([]int, len(blogs))
+	for i, blog := range blogs {
+		ids[i] = blog.ID
+	}
+
+	tags, err := app.blogs.TagsFor(ids)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, blog := range blogs {
+		blog.Tags = tags[blog.ID]
+		feed.Items = append(feed.Items, app.newJSONFeedItem(r, blog))
+	}
+
+	js, err := json.MarshalIndent(feed, "", "\t")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+	w.Write(js)
+}
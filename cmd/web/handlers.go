@@ -5,9 +5,14 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/outline"
+	"github.com/munnaMia/Story-Book/internal/spam"
+	"github.com/munnaMia/Story-Book/internal/summary"
 	"github.com/munnaMia/Story-Book/internal/validator"
 )
 
@@ -21,8 +26,17 @@ import (
 type blogCreateForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
+	Lang                string `form:"lang"`
 	Expires             int    `form:"expires"`
+	Media               []int  `form:"media"`
+	CoverID             int    `form:"cover_id"`
+	CoverAlt            string `form:"cover_alt"`
+	SeriesID            int    `form:"series"`
+	NewSeries           string `form:"new_series"`
+	SeriesPart          int    `form:"series_part"`
+	Tags                string `form:"tags"`
 	validator.Validator `form:"-"`
+	antispam
 }
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
@@ -35,14 +49,27 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 		update with httprouter pkg:
 		if r.URL.Path != "/" {
-			app.notFound(w)
+			app.notFound(w, r)
 			return
 		}
 	*/
 
 	blogs, err := app.blogs.Latest()
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Get the reaction counts of all the blogs with one query.
+	ids := make([]int, len(blogs))
+	for i, blog := range blogs {
+		ids[i] = blog.ID
+	}
+
+	counts, err := app.reactions.CountsFor(ids)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
 
 	// Call the newTemplateData() helper to get a templateData struct containing
@@ -50,8 +77,12 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	// snippets slice to it.
 	data := app.newTemplateData(r)
 	data.Blogs = blogs
+	data.Reactions = map[int][]reaction{}
+	for _, blog := range blogs {
+		data.Reactions[blog.ID] = reactionList(counts[blog.ID], false)
+	}
 
-	app.render(w, http.StatusOK, "home.html", data)
+	app.render(w, r, http.StatusOK, "home.html", data)
 }
 
 func (app *application) blogView(w http.ResponseWriter, r *http.Request) {
@@ -65,7 +96,7 @@ func (app *application) blogView(w http.ResponseWriter, r *http.Request) {
 	// id which given by user should be a int and bigger then 0.
 	id, err := strconv.Atoi(param.ByName("id"))
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
@@ -74,9 +105,9 @@ func (app *application) blogView(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		if errors.Is(err, model.ErrNoRecord) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
@@ -87,24 +118,189 @@ func (app *application) blogView(w http.ResponseWriter, r *http.Request) {
 	// // data this will return the empty string.
 	// flash := app.sessionManager.PopString(r.Context(), "flash")
 
+	app.showBlog(w, r, http.StatusOK, blog, nil, commentForm{})
+}
+
+// showBlog() renders the view page of a blog. When translation isn't nil the
+// page shows the translation, and the blog is the canonical post it belongs to.
+// The form is the comment form, which has errors in it when a comment didn't
+// pass validation.
+func (app *application) showBlog(w http.ResponseWriter, r *http.Request, status int, blog *model.Blog, translation *model.Translation, form commentForm) {
+	translations, err := app.translations.ForBlog(blog.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	comments, err := app.comments.ForBlog(blog.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	reactions, err := app.reactions.Counts(blog.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	images, err := app.media.ForBlog(blog.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Most blogs aren't in a series, that's not an error.
+	series, err := app.series.ForBlog(blog.ID)
+	if err != nil && !errors.Is(err, model.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	tags, err := app.blogs.TagsFor([]int{blog.ID})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var relatedBlogs []*model.Blog
+	if app.config.relatedPosts > 0 {
+		relatedBlogs, err = app.related.ForBlog(blog.ID, app.config.relatedPosts)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Make a copy of the blog with the title and content in the language
+	// being shown, so view.html doesn't need to know about translations.
+	shown := *blog
+	shown.Tags = tags[blog.ID]
+	if translation != nil {
+		shown.Title = translation.Title
+		shown.Content = translation.Content
+		shown.Lang = translation.Lang
+
+		sum := summary.Of(translation.Content)
+		shown.Words, shown.Minutes, shown.Excerpt = sum.Words, sum.ReadingTime, sum.Excerpt
+	}
+
+	// The text shown was last changed when the blog or its translation was
+	// written, that's the DateModified of the JSON-LD. The page as a whole
+	// was last changed at blog.Modified (comments, reactions, the expiry and
+	// so on move it on, see internal/model/blogs.go) or when the
+	// translation was written, which is the Last-Modified header.
+	written := blog.Created
+	if translation != nil && translation.Created.After(written) {
+		written = translation.Created
+	}
+
+	modified := blog.Modified
+	if written.After(modified) {
+		modified = written
+	}
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+
+	// The view of the page counts for the blog, see analytics.go.
+	setViewBlog(r, blog.ID)
+
 	data := app.newTemplateData(r)
-	data.Blog = blog
+	data.Blog = &shown
+	// Split the content at its headings for the table of contents. The
+	// headings mustn't get the ids the rest of the page links to.
+	data.Outline = outline.Parse(shown.Content, "reactions", "comments")
+	data.Comments = comments
+	data.Media = images
+	data.Related = relatedBlogs
+	data.Reactions = map[int][]reaction{blog.ID: reactionList(reactions, true)}
+	data.Form = form
+	// No FormStamp, the page is cached. main.js fetches one, see spam.go.
+	if series != nil {
+		data.Series = series
+		data.SeriesPart, data.PrevBlog, data.NextBlog = seriesNeighbours(series, blog.ID)
+	}
 	// data.Flash = flash// Pass the flash message to the template.
 
-	app.render(w, http.StatusOK, "view.html", data)
+	// Fill in the share preview of the blog. The description is the excerpt,
+	// the first sentences of the content.
+	data.Meta.Title = shown.Title
+	if shown.Excerpt != "" {
+		data.Meta.Description = shown.Excerpt
+	}
+	data.Meta.Type = "article"
+	data.Meta.Alternates = app.blogAlternates(r, blog, translations, shown.Lang)
+
+	// The cover is the share image. A blog without one uses its first
+	// image, if it has any.
+	if blog.Cover != nil {
+		app.setShareImage(r, &data.Meta, blog.Cover, blog.CoverAlt)
+	} else if len(images) > 0 {
+		app.setShareImage(r, &data.Meta, images[0], images[0].Name)
+	}
+
+	data.Meta.JSONLD = blogPosting{
+		Context:          "https://schema.org",
+		Type:             "BlogPosting",
+		Headline:         shown.Title,
+		Description:      data.Meta.Description,
+		URL:              data.Meta.CanonicalURL,
+		MainEntityOfPage: data.Meta.CanonicalURL,
+		InLanguage:       shown.Lang,
+		DatePublished:    blog.Created.UTC().Format(time.RFC3339),
+		DateModified:     written.UTC().Format(time.RFC3339),
+		Image:            data.Meta.Image,
+		Author:           schemaPerson{Type: "Person", Name: app.config.author},
+	}
+
+	app.render(w, r, status, "view.html", data)
 }
 
 func (app *application) blogCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
 	// Initialize a new createSnippetForm instance and pass it to the template.
 	// Notice how this is also a great opportunity to set any default or
 	// 'initial' values for the form --- here we set the initial value for the
 	// snippet expiry to 365 days.
-	data.Form = blogCreateForm{
+	form := blogCreateForm{
+		Lang:    app.localizer(r).Lang,
 		Expires: 365,
 	}
 
-	app.render(w, http.StatusOK, "create.html", data)
+	app.showCreateForm(w, r, http.StatusOK, form)
+}
+
+// showCreateForm() renders the create page with the form, and the latest
+// images of the media library to pick from.
+func (app *application) showCreateForm(w http.ResponseWriter, r *http.Request, status int, form blogCreateForm) {
+	// The media library is only for the moderators, see media.go. Everybody
+	// else can only upload images of their own.
+	var library []*model.Media
+	var err error
+	if app.moderator(r) != "" {
+		library, err = app.media.Page(mediaPageSize, 0)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Series hold the blogs of other people too, so only the moderators get
+	// the list to add the blog to one. Everybody can start a new one.
+	var seriesList []*model.Series
+	if app.moderator(r) != "" {
+		seriesList, err = app.series.All()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.FormStamp = app.formStamp()
+	data.Media = library
+	data.SeriesList = seriesList
+
+	app.render(w, r, status, "create.html", data)
 }
 
 func (app *application) blogCreatePost(w http.ResponseWriter, r *http.Request) {
@@ -131,7 +327,7 @@ func (app *application) blogCreatePost(w http.ResponseWriter, r *http.Request) {
 	// 			w.Write([]byte("Method Not Allowed"))
 	// 	*/
 	// 	w.Header().Set("Allow", http.MethodPost)
-	// 	app.clientError(w, http.StatusMethodNotAllowed)
+	// 	app.clientError(w, r, http.StatusMethodNotAllowed)
 	// 	return
 	// }
 
@@ -141,45 +337,305 @@ func (app *application) blogCreatePost(w http.ResponseWriter, r *http.Request) {
 	// send a 400 Bad Request response to the user.
 	// err := r.ParseForm()
 	// if err != nil {
-	// 	app.clientError(w, http.StatusBadRequest)
+	// 	app.clientError(w, r, http.StatusBadRequest)
 	// 	return
 	// }
 
+	// The form can have images in it, so it's sent as multipart/form-data.
+	// parseUploadForm() reads it (and refuses it when it's too big), after
+	// which decodePostForm() finds the fields in r.PostForm as usual.
+	err := app.parseUploadForm(w, r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.clientError(w, r, http.StatusRequestEntityTooLarge)
+		} else {
+			app.clientError(w, r, http.StatusBadRequest)
+		}
+		return
+	}
+
 	var form blogCreateForm
 
 	// Call the Decode() method of the form decoder, passing in the current
 	// request and *a pointer* to our snippetCreateForm struct. This will
 	// essentially fill our struct with the relevant values from the HTML form.
 	// If there is a problem, we return a 400 Bad Request response to the client.
-	err := app.decodePostForm(r, &form)
+	err = app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	// The messages are keys in the message catalogs, the validator translates
+	// them into the language of the request.
+	form.T = app.localizer(r).T
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "validation.blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "validation.max_chars", 100)
+	form.CheckField(validator.NotBlank(form.Content), "content", "validation.blank")
+	form.CheckField(app.i18n.Has(form.Lang), "lang", "validation.lang")
+	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "validation.expires")
+
+	// Blogs have no moderation queue, so only the spam the filter is sure
+	// about is stopped.
+	if form.Valid() && app.checkSpam(r, form.antispam, form.Title, form.Content).Verdict == spam.Reject {
+		form.AddFieldError("content", "validation.spam")
+	}
+
+	// Only the moderators have the library to pick images from, see
+	// showCreateForm().
+	if app.moderator(r) == "" {
+		form.Media, form.CoverID = nil, 0
+	}
+
+	// The images picked from the library must exist.
+	for _, id := range form.Media {
+		_, err := app.media.Get(id)
+		if errors.Is(err, model.ErrNoRecord) {
+			form.AddFieldError("media", "validation.media")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// The cover is a new upload or an image picked from the library (the
+	// upload wins when there are both), and it needs an alt text.
+	coverUpload := r.MultipartForm != nil && len(r.MultipartForm.File["cover"]) > 0
+	if form.CoverID != 0 {
+		_, err := app.media.Get(form.CoverID)
+		if errors.Is(err, model.ErrNoRecord) {
+			form.AddFieldError("cover", "validation.media")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if coverUpload || form.CoverID != 0 {
+		form.CheckField(validator.NotBlank(form.CoverAlt), "cover_alt", "validation.blank")
+	}
+	form.CheckField(validator.MaxChars(form.CoverAlt, 255), "cover_alt", "validation.max_chars", 255)
+
+	// The blog can go into a series from the list, or into a new one (which
+	// wins when there are both). The slug of a new series is made from its
+	// name, so the name needs some letters or digits and mustn't be taken.
+	// Only the moderators have the list, see showCreateForm().
+	if app.moderator(r) == "" {
+		form.SeriesID, form.SeriesPart = 0, 0
+	}
+	form.NewSeries = strings.TrimSpace(form.NewSeries)
+	if form.NewSeries != "" {
+		form.CheckField(validator.MaxChars(form.NewSeries, 100), "new_series", "validation.max_chars", 100)
+		form.CheckField(slugify(form.NewSeries) != "", "new_series", "validation.series_name")
+
+		_, err := app.series.GetBySlug(slugify(form.NewSeries))
+		if err == nil {
+			form.AddFieldError("new_series", "validation.series_taken")
+		} else if !errors.Is(err, model.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+	} else if form.SeriesID != 0 {
+		_, err := app.series.Get(form.SeriesID)
+		if errors.Is(err, model.ErrNoRecord) {
+			form.AddFieldError("series", "validation.series")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	form.CheckField(form.SeriesPart >= 0, "series_part", "validation.series_part")
+
+	// Tags are typed in comma separated and saved as slugs.
+	tags := parseTags(form.Tags)
+	form.CheckField(len(tags) <= maxTags, "tags", "validation.tags", maxTags)
+	for _, tag := range tags {
+		form.CheckField(validator.MaxChars(tag, 50), "tags", "validation.tag_length", 50)
+	}
+
+	// The uploads are only saved once the rest of the form is fine, so a
+	// form with mistakes doesn't fill the library with copies.
+	var uploads []*model.Media
+	if form.Valid() {
+		uploads, err = app.saveUploads(r, "images", &form.Validator)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if form.Valid() && coverUpload {
+		covers, err := app.saveUploads(r, "cover", &form.Validator)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if len(covers) > 0 {
+			form.CoverID = covers[0].ID
+		}
+	}
 
 	// If there are any errors, dump them in a plain text HTTP response and
 	// return from the handler.
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.html", data)
+		app.showCreateForm(w, r, http.StatusUnprocessableEntity, form)
 		return
 	}
 
+	// The blog, its images, series and tags are saved in one transaction, so
+	// a failure half way doesn't leave a blog with only some of them.
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	// Rollback() does nothing once Commit() succeeded.
+	defer tx.Rollback()
+
 	// pass data to insert method
-	id, err := app.blogs.Insert(form.Title, form.Content, form.Expires)
+	id, err := app.blogs.InsertTx(tx, form.Title, form.Content, form.Lang, form.Expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Add the new uploads and the picked images to the blog, in that order.
+	mediaIDs := []int{}
+	for _, m := range uploads {
+		mediaIDs = append(mediaIDs, m.ID)
+	}
+	mediaIDs = append(mediaIDs, form.Media...)
+
+	err = app.media.AttachTx(tx, id, mediaIDs)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if form.CoverID != 0 {
+		err = app.blogs.SetCoverTx(tx, id, form.CoverID, form.CoverAlt)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	seriesID := form.SeriesID
+	if form.NewSeries != "" {
+		seriesID, err = app.series.InsertTx(tx, slugify(form.NewSeries), form.NewSeries, "")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if seriesID != 0 {
+		err = app.series.AddTx(tx, seriesID, id, form.SeriesPart)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = app.blogs.SetTagsTx(tx, id, tags)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = tx.Commit()
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Blog successfully created!")
+	// The related posts are worked out in the background, see related.go. The
+	// worker reads the blog, so only once it's committed.
+	app.queueRelated(id)
+
+	app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T("flash.blog_created"))
 
 	// Redirect the user to the relevant page for the snippet.
 	http.Redirect(w, r, fmt.Sprintf("/blog/view/%d", id), http.StatusSeeOther)
 }
+
+// localeForm is the form of the language switcher in the nav.
+type localeForm struct {
+	Lang string `form:"lang"`
+}
+
+// localeSet saves the language picked in the language switcher in the "lang"
+// cookie, which negotiateLocale reads on every request, and sends the user
+// back to the page they came from.
+func (app *application) localeSet(w http.ResponseWriter, r *http.Request) {
+	var form localeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || !app.i18n.Has(form.Lang) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	setPreferenceCookie(w, "lang", form.Lang)
+
+	back := localPath(r.Referer(), "/")
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// preferencesForm is the form of the preferences page.
+type preferencesForm struct {
+	Lang                string `form:"lang"`
+	Timezone            string `form:"timezone"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) preferences(w http.ResponseWriter, r *http.Request) {
+	loc := app.localizer(r)
+
+	data := app.newTemplateData(r)
+	data.Timezones = commonTimezones
+	data.Form = preferencesForm{
+		Lang:     loc.Lang,
+		Timezone: loc.Location.String(),
+	}
+
+	app.render(w, r, http.StatusOK, "preferences.html", data)
+}
+
+// preferencesPost saves the language and timezone in cookies. We don't have
+// user accounts, so the cookies are where a visitor's preferences live.
+func (app *application) preferencesPost(w http.ResponseWriter, r *http.Request) {
+	var form preferencesForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.T = app.localizer(r).T
+
+	// time.LoadLocation() knows every IANA timezone name, like "Asia/Dhaka".
+	_, tzErr := time.LoadLocation(form.Timezone)
+
+	form.CheckField(app.i18n.Has(form.Lang), "lang", "validation.lang")
+	form.CheckField(validator.NotBlank(form.Timezone) && tzErr == nil, "timezone", "validation.timezone")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Timezones = commonTimezones
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "preferences.html", data)
+		return
+	}
+
+	setPreferenceCookie(w, "lang", form.Lang)
+	setPreferenceCookie(w, "tz", form.Timezone)
+
+	// The flash is shown on the next page, which is in the new language.
+	app.sessionManager.Put(r.Context(), "flash", app.i18n.Translate(form.Lang, "flash.preferences_saved"))
+
+	http.Redirect(w, r, "/preferences", http.StatusSeeOther)
+}
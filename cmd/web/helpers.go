@@ -3,18 +3,24 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
+	"github.com/munnaMia/Story-Book/internal/i18n"
 )
 
 // The serverError helper writes an error message and stack trace to the errorLog,
 // then sends a generic 500 Internal Server Error response to the user.
-func (app *application) serverError(w http.ResponseWriter, err error) {
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	/*
 		In the serverError() helper we use the debug.Stack() function to get a stack trace
 		for the current goroutine and append it to the log message.
@@ -24,33 +30,166 @@ func (app *application) serverError(w http.ResponseWriter, err error) {
 	trace := fmt.Sprintf("%s \n %s", err.Error(), debug.Stack())
 	app.errorLog.Output(2, trace) // depth 2 reason to find where the error occur from the stack.
 
-	// e http.StatusText() function to automatically generate a human-friendly text representation of a given HTTP status code
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	// In development mode show the error and the stack trace in the browser
+	// instead of the bare 500 page.
+	if app.config.dev {
+		w.Header().Set("Cache-Control", "no-store")
+		app.debugPage(w, err, debug.Stack())
+		return
+	}
+
+	app.errorResponse(w, r, http.StatusInternalServerError)
 }
 
 // The clientError helper sends a specific status code and corresponding description to the user.
-func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	app.errorResponse(w, r, status)
 }
 
 // we'll also implement a notFound helper. This is simply a
 // convenience wrapper around clientError which sends a 404 Not Found response to
 // the user.
-func (app *application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusNotFound)
 }
 
-func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
+/*
+	errorResponse
+	=============
+		sends an error status to the user in the format they asked for:
+
+			- a JSON object for API requests (Accept: application/json),
+			- the error.html page, with base.html and the nav, for everybody else,
+			- plain text like http.Error() if the error page itself fails to
+			  render, so a broken template can never hide the real error.
+
+		Note:
+			We don't use render() here. It calls serverError() when something
+			goes wrong, which would call us again. The template data is also
+			built without newTemplateData(), because errors can happen on
+			routes without a session (like the router's NotFound handler).
+*/
+
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int) {
+	// The friendly message for the status is in the message catalogs under
+	// "error.message.<status>". Any other status just gets its
+	// http.StatusText().
+	loc := app.localizer(r)
+
+	key := fmt.Sprintf("error.message.%d", status)
+	message := loc.T(key)
+	if message == key {
+		message = http.StatusText(status)
+	}
+
+	app.localized(w, r)
+
+	// Routes may have set a public Cache-Control header already; server
+	// errors must never be cached by a CDN.
+	if status >= 500 {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	if wantsJSON(r) {
+		js, err := json.Marshal(map[string]any{
+			"status":  status,
+			"error":   http.StatusText(status),
+			"message": message,
+		})
+		if err != nil {
+			app.errorLog.Output(2, err.Error())
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		w.Write(js)
+		return
+	}
+
+	data := &templateData{
+		CurrentYear: time.Now().Year(),
+		Loc:         loc,
+		Languages:   app.languages(),
+		Status:      status,
+		StatusText:  http.StatusText(status),
+		Message:     message,
+		Meta: pageMeta{
+			CanonicalURL: app.absoluteURL(r, r.URL.Path),
+			Description:  loc.T("meta.description"),
+			Type:         "website",
+		},
+	}
+
+	buf := new(bytes.Buffer)
+
+	ts, ok := app.themeFor(r).templateCache["error.html"]
+	if !ok {
+		app.errorLog.Output(2, "the template error.html does not exist")
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	if err := ts.ExecuteTemplate(buf, "base", data); err != nil {
+		app.errorLog.Output(2, err.Error())
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// wantsJSON() reports whether the client asked for a JSON response, like the
+// JSON feed readers and API clients do.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") || strings.Contains(accept, "+json")
+}
+
+// writeJSON() sends v as a JSON response with the given status.
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data *templateData) {
 	/*
 		Retrieve the appropriate template set from the cache based on the page
 		name (like 'home.tmpl'). If no entry exists in the cache with the
 		provided name, then create a new error and call the serverError() helper
 		method that we made earlier and return.
 	*/
-	ts, ok := app.templateCache[page]
+	// Every theme has its own template cache, the request's host picks the theme.
+	theme := app.themeFor(r)
+	templateCache := theme.templateCache
+
+	// In development mode parse the templates again on every request, so
+	// changes to the html files show up without restarting the server.
+	if app.config.dev {
+		var err error
+		templateCache, err = newTemplateCache(theme.ui, theme.assets)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	ts, ok := templateCache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
 	}
 
 	// Initialize the buffer
@@ -63,10 +202,36 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 	*/
 	err := ts.ExecuteTemplate(buf, "base", data)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
+	app.localized(w, r)
+
+	/*
+		Conditional GET
+		===============
+			Because the whole page is already in the buffer we can hash it to
+			get a strong ETag. If the browser (or a CDN) already has this exact
+			page it sends the ETag back in If-None-Match and we answer with a
+			304 Not Modified and no body.
+
+			Note:
+				Only successful GET/HEAD responses get an ETag. A page showing
+				a flash message is only for this one visitor, so it's marked
+				as not cacheable instead.
+	*/
+	if data.Flash != "" {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else if status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		w.Header().Set("ETag", etag(buf.Bytes()))
+
+		if notModified(w, r) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
 	/*
 		Write out the provided HTTP status code ('200 OK', '400 Bad Request' etc).
 		If the template is written to the buffer without any errors, we are safe
@@ -83,14 +248,71 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 
 }
 
+// etag() returns a strong ETag for a response body. We use the first 16 bytes
+// of the SHA-256 sum, which is plenty to tell two pages apart.
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified() reports whether the client's cached copy is still fresh, by
+// comparing the request's If-None-Match and If-Modified-Since headers with the
+// ETag and Last-Modified headers already set on the response. Like the HTTP
+// spec says, If-Modified-Since is only used when there is no If-None-Match.
+func notModified(w http.ResponseWriter, r *http.Request) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		current := w.Header().Get("ETag")
+		if current == "" {
+			return false
+		}
+
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == current {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	modified, err := http.ParseTime(w.Header().Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
 // Create an newTemplateData() helper, which returns a pointer to a templateData
 // struct initialized with the current year. Note that we're not using the
 // *http.Request parameter here at the moment, but we will do later.
 func (app *application) newTemplateData(r *http.Request) *templateData {
-	return &templateData{
+	loc := app.localizer(r)
+
+	data := &templateData{
 		CurrentYear: time.Now().Year(),
-		Flash: app.sessionManager.PopString(r.Context(), "flash"),
+		Flash:       app.sessionManager.PopString(r.Context(), "flash"),
+		Loc:         loc,
+		Languages:   app.languages(),
+		Meta: pageMeta{
+			CanonicalURL: app.absoluteURL(r, r.URL.Path),
+			Description:  loc.T("meta.description"),
+			Type:         "website",
+		},
 	}
+
+	// The public pages are cached and the same for everybody, so only the
+	// moderators' pages get the token of the session.
+	if app.moderator(r) != "" {
+		data.CSRFToken = app.csrfToken(r)
+	}
+
+	return data
 }
 
 // Create a new decodePostForm() helper method. The second parameter here, dst,
@@ -116,3 +338,103 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	}
 	return err
 }
+
+// absoluteURL() turns a path like "/blog/view/1" into a full URL. Feeds and
+// share previews need absolute URLs because they are read outside of our site.
+// The host is the one of -base-url, or the host of the request when it's one
+// of the -site-themes hosts. Any other Host header is never trusted: the pages
+// are cached publicly, so a forged one would be handed to everybody.
+func (app *application) absoluteURL(r *http.Request, path string) string {
+	host := strings.ToLower(hostname(r.Host))
+
+	// Only in -dev mode, see parseBaseURL().
+	if app.config.baseURL == "" {
+		return "http://" + r.Host + path
+	}
+
+	base, _ := url.Parse(app.config.baseURL)
+	if _, ok := app.siteThemes[host]; ok && host != base.Hostname() {
+		base.Host = host
+	}
+	return strings.TrimRight(base.String(), "/") + path
+}
+
+// parseBaseURL() checks the value of the -base-url flag, which must be an
+// http or https URL. It can only be left out in development mode.
+func parseBaseURL(s string, dev bool) (string, error) {
+	if s == "" {
+		if dev {
+			return "", nil
+		}
+		return "", errors.New("-base-url is required, like -base-url=\"https://storybook.example.com\" (or use -dev)")
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid -base-url %q, want a URL like https://storybook.example.com", s)
+	}
+	return strings.TrimRight(s, "/"), nil
+}
+
+// localizer() returns the i18n.Localizer the negotiateLocale middleware chose
+// for the request, or the one for the default language.
+func (app *application) localizer(r *http.Request) i18n.Localizer {
+	if l, ok := r.Context().Value(localizerContextKey).(i18n.Localizer); ok {
+		return l
+	}
+	return app.i18n.Localizer(app.i18n.Fallback())
+}
+
+// localized() sets the headers of a response which is in the language of the
+// request. The same URL gives a different page for every language, so caches
+// must keep them apart.
+func (app *application) localized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept-Language, Cookie")
+	w.Header().Set("Content-Language", app.localizer(r).Lang)
+}
+
+// languages() returns the languages we have catalogs for, for the language
+// switcher in the nav.
+func (app *application) languages() []language {
+	langs := []language{}
+	for _, code := range app.i18n.Languages() {
+		langs = append(langs, language{
+			Code: code,
+			Name: app.i18n.Translate(code, "language.name"),
+		})
+	}
+	return langs
+}
+
+// localPath() returns the path of rawURL if it's a path on our own site, or
+// fallback when it isn't. Only the path is used, so a redirect to it can never
+// send the user to another site. Paths starting with "//" or "/\" are left out
+// as well, because browsers treat those as links to another host.
+func localPath(rawURL, fallback string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.HasPrefix(u.Path, "/") {
+		return fallback
+	}
+
+	if strings.HasPrefix(u.Path, "//") || strings.HasPrefix(u.Path, "/\\") {
+		return fallback
+	}
+
+	return u.Path
+}
+
+// setPreferenceCookie() stores one of the visitor's preferences (like "lang" or
+// "tz") in a cookie which lasts a year.
+//
+// Note: the cookies are not HttpOnly. main.js reads the "tz" cookie to know
+// if it still has to send the browser's timezone, and a language or timezone
+// is nothing secret.
+func setPreferenceCookie(w http.ResponseWriter, name, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
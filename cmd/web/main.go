@@ -21,26 +21,91 @@ package main
 import (
 	"database/sql"
 	"flag"
-	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"time"
+	_ "time/tzdata" // so time.LoadLocation() works on machines without a timezone database
 
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/munnaMia/Story-Book/internal/i18n"
 	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/spam"
+	"github.com/munnaMia/Story-Book/internal/storage"
+	"github.com/munnaMia/Story-Book/ui"
 )
 
+// config struct to hold all the configuration settings for the application which
+// are read from the command-line flags when the application starts.
+type config struct {
+	addr           string
+	dsn            string
+	author         string
+	robotsDisallow string
+	baseURL        string
+	uiDir          string
+	dev            bool
+	themesDir      string
+	theme          string
+	siteThemes     string
+	lang           string
+	moderators     string
+	admins         string
+	spamSecret     string
+	mediaDir       string
+	maxUpload      int64
+	mediaQuota     int64
+	visitorUploads int64
+	storage        string
+	s3Endpoint     string
+	s3Region       string
+	s3Bucket       string
+	s3Prefix       string
+	s3AccessKey    string
+	s3SecretKey    string
+	s3PathStyle    bool
+	staticURL      string
+	relatedPosts   int
+	analytics      bool
+	spamBlocklist  string
+	spamApprove    float64
+	spamReject     float64
+}
+
 // application struct to hold the application-wide dependencies for the web application.
 // lower case struct name for internal use
 type application struct {
+	config         config
 	infoLog        *log.Logger
 	errorLog       *log.Logger
 	blogs          *model.BlogModel
-	templateCache  map[string]*template.Template
+	translations   *model.TranslationModel
+	comments       *model.CommentModel
+	reactions      *model.ReactionModel
+	media          *model.MediaModel
+	series         *model.SeriesModel
+	related        *model.RelatedModel
+	relatedQueue   chan int
+	pageViews      *model.PageViewModel
+	views          chan model.PageView
+	visitorSalt    *visitorSalt
+	uploads        *uploadAllowance
+	storage        storage.Storage
+	moderators     map[string]string
+	admins         map[string]bool
+	staff          *model.StaffModel
+	sessions       *model.SessionModel
+	db             *sql.DB
+	started        time.Time
+	spam           *spam.Filter
+	spamKey        []byte
+	themes         map[string]*theme
+	siteThemes     map[string]string
+	i18n           *i18n.Bundle
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
 }
@@ -65,14 +130,112 @@ func main() {
 		How to use it?
 			EX --> go run .\cmd\web\. -addr=":8000"
 	*/
-	addr := flag.String("addr", "localhost:8080", "HTTP network address")
+	var cfg config
+
+	flag.StringVar(&cfg.addr, "addr", "localhost:8080", "HTTP network address")
 
 	/*
 		Note: A quirk of our MySQL driver is that we need to use the parseTime=true parameter
 		in our DSN to force it to convert TIME and DATE fields to time.Time. Otherwise it returns
 		these as []byte objects. This is one of the many driver-specific parameters that it offers.
 	*/
-	dsn := flag.String("dsn", "webhost:pass@/storybook?parseTime=true", "MySQL data source name")
+	flag.StringVar(&cfg.dsn, "dsn", "webhost:pass@/storybook?parseTime=true", "MySQL data source name")
+
+	// base-url is the public address of the site, like https://storybook.example.com.
+	// It's used for canonical links and the share previews of blog pages.
+	// It's required unless -dev is on: those pages are cached by shared
+	// caches, so the address can't come from the Host header of whoever
+	// asked first.
+	flag.StringVar(&cfg.baseURL, "base-url", "", "Public base URL of the site (required unless -dev is on)")
+
+	// ui-dir loads the templates and static files from a folder on disk instead
+	// of the copies embedded in the binary, EX --> -ui-dir="./ui" while
+	// working on the templates or to use a different look.
+	flag.StringVar(&cfg.uiDir, "ui-dir", "", "Load templates and static files from this directory instead of the embedded ones")
+
+	// dev turns on development mode: templates are parsed again on every request
+	// and server errors show a debug page with the stack trace. Never use it in
+	// production, the debug page shows the inside of the application.
+	flag.BoolVar(&cfg.dev, "dev", false, "Development mode (reload templates, show debug error pages)")
+
+	// Themes, see themes.go. EX --> -theme="dark" to use themes/dark for every
+	// site, or -site-themes="a.example.com=dark,b.example.com=light" to pick
+	// the theme by the host name of the request.
+	flag.StringVar(&cfg.themesDir, "themes-dir", "./themes", "Directory containing the theme folders")
+	flag.StringVar(&cfg.theme, "theme", defaultTheme, "Theme used for sites without their own theme")
+	flag.StringVar(&cfg.siteThemes, "site-themes", "", "Comma separated host=theme pairs")
+
+	// lang is the default language, used when none of the visitor's languages
+	// has a message catalog in ui/locales.
+	flag.StringVar(&cfg.lang, "lang", "en", "Default language")
+
+	// moderators are the people who can use the comment moderation queue, as
+	// comma separated name:password pairs. We don't have user accounts, so
+	// they log in with HTTP basic authentication.
+	// EX --> -moderators="munna:secret,rafi:another-secret"
+	flag.StringVar(&cfg.moderators, "moderators", "", "Comma separated name:password pairs of the comment moderators")
+
+	// admins are the moderators who can always use the admin dashboard, see
+	// admin.go. The dashboard can make other moderators admins too, but not
+	// take it away from these. EX --> -admins="munna"
+	flag.StringVar(&cfg.admins, "admins", "", "Comma separated names of the moderators who are always admins")
+
+	// Uploaded images, see media.go. EX --> -max-upload=5242880 for 5 MB.
+	flag.StringVar(&cfg.mediaDir, "media-dir", "./media", "Directory the uploaded images are stored in")
+	flag.Int64Var(&cfg.maxUpload, "max-upload", 10<<20, "Largest image upload in bytes")
+
+	// media-quota caps the size of the whole media library, the uploads
+	// added up (the resized copies take roughly as much again). 0 turns it
+	// off. EX --> -media-quota=5368709120 for 5 GB.
+	flag.Int64Var(&cfg.mediaQuota, "media-quota", 1<<30, "Largest total size of the media library in bytes (0 for no limit)")
+
+	// visitor-uploads caps what one IP address which isn't a moderator can
+	// upload in a day, so one visitor can't fill the whole -media-quota. 0
+	// turns it off. EX --> -visitor-uploads=52428800 for 50 MB.
+	flag.Int64Var(&cfg.visitorUploads, "visitor-uploads", 20<<20, "Most bytes of images a visitor can upload in a day (0 for no limit)")
+
+	// storage picks where the uploaded images are kept: "disk" is the
+	// -media-dir folder, "s3" is a bucket of an S3-compatible object store
+	// (see internal/storage/s3.go). The keys can also come from the usual
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables,
+	// which keeps them out of the process list.
+	// EX --> -storage="s3" -s3-endpoint="http://localhost:9000" -s3-bucket="storybook"
+	flag.StringVar(&cfg.storage, "storage", "disk", "Where uploads are stored: disk or s3")
+	flag.StringVar(&cfg.s3Endpoint, "s3-endpoint", "", "S3 endpoint URL (defaults to Amazon S3 in -s3-region)")
+	flag.StringVar(&cfg.s3Region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&cfg.s3Bucket, "s3-bucket", "", "S3 bucket name")
+	flag.StringVar(&cfg.s3Prefix, "s3-prefix", "", "Prefix of every key in the S3 bucket")
+	flag.StringVar(&cfg.s3AccessKey, "s3-access-key", os.Getenv("AWS_ACCESS_KEY_ID"), "S3 access key")
+	flag.StringVar(&cfg.s3SecretKey, "s3-secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "S3 secret key")
+	flag.BoolVar(&cfg.s3PathStyle, "s3-path-style", true, "Put the S3 bucket in the URL path instead of the host name")
+
+	// static-url is where the static files are served from when they were
+	// copied into object storage with the "media push-static" command,
+	// EX --> -static-url="https://cdn.example.com/static"
+	flag.StringVar(&cfg.staticURL, "static-url", "", "Base URL of the static files in object storage (defaults to /static)")
+
+	// related-posts is how many related blogs are listed under every blog,
+	// see related.go. 0 turns them off.
+	flag.IntVar(&cfg.relatedPosts, "related-posts", 5, "Number of related blogs shown under a blog (0 to turn them off)")
+
+	// analytics counts the views of the pages, see analytics.go.
+	flag.BoolVar(&cfg.analytics, "analytics", true, "Count page views for the /admin/stats dashboard")
+
+	// The spam filter, see spam.go. Comments scoring under -spam-approve are
+	// published without moderation, and anything scoring -spam-reject or
+	// more is thrown out. spam-secret signs the form stamps, so it must be
+	// the same on every server behind a load balancer.
+	flag.StringVar(&cfg.spamSecret, "spam-secret", "", "Secret key for signing form stamps (random if empty)")
+	flag.StringVar(&cfg.spamBlocklist, "spam-blocklist", "", "File with one blocked term per line")
+	flag.Float64Var(&cfg.spamApprove, "spam-approve", -2, "Spam score under which comments are approved without moderation")
+	flag.Float64Var(&cfg.spamReject, "spam-reject", 5, "Spam score from which submissions are rejected")
+
+	// author is the name shown as the author of every blog in the feeds.
+	flag.StringVar(&cfg.author, "author", "Munna", "Author name used in the blog feeds")
+
+	// robots-disallow is a comma separated list of paths that robots.txt asks
+	// crawlers to stay away from. EX --> -robots-disallow="/blog/create,/admin"
+	flag.StringVar(&cfg.robotsDisallow, "robots-disallow", "/blog/create", "Comma separated paths disallowed in robots.txt")
 
 	/*
 		Parse()
@@ -85,8 +248,10 @@ func main() {
 		Note :
 			use -help flag to get all flags info.
 
-		Research :
-			flag.StringVar and how to use it with struct to store cofigs data.
+		flag.StringVar
+		--------------
+		instead of getting a pointer back from flag.String we pass a pointer to
+		a field of the config struct and the parsed value is stored there.
 	*/
 	flag.Parse()
 
@@ -99,20 +264,85 @@ func main() {
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	// Anything left after the flags is a command to run instead of the
+	// server, see commands.go. EX --> go run ./cmd/web -storage=s3 ... media migrate -from=disk -to=s3
+	if flag.NArg() > 0 {
+		if err := runCommand(cfg, flag.Args(), infoLog); err != nil {
+			errorLog.Fatal(err)
+		}
+		return
+	}
+
+	baseURL, err := parseBaseURL(cfg.baseURL, cfg.dev)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	cfg.baseURL = baseURL
+
 	/*
 		To keep the main() function tidy I've put the code for creating a connection
 		pool into the separate openDB() function below. We pass openDB() the DSN
 		from the command-line flag.
 	*/
-	db, err := openDB(*dsn)
+	db, err := openDB(cfg.dsn)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 
 	defer db.Close()
 
-	// Initialize a new template cache...
-	templateCache, err := newTemplateCache()
+	// The ui file system is the embedded ui.Files unless -ui-dir was given,
+	// in which case os.DirFS() reads the same layout from disk.
+	// In development mode we want to see template edits straight away, and
+	// the embedded copy never changes, so the templates are read from ./ui on
+	// disk unless another folder was given.
+	if cfg.dev && cfg.uiDir == "" {
+		cfg.uiDir = "./ui"
+	}
+
+	uiFS := uiFiles(cfg)
+
+	siteThemes, err := parseSiteThemes(cfg.siteThemes)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Build every theme we need, each with its own template cache...
+	themes, err := loadThemes(cfg, uiFS, siteThemes)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	moderators, err := parseModerators(cfg.moderators)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	if len(moderators) == 0 {
+		infoLog.Print("No -moderators given, comments can't be moderated")
+	}
+
+	admins, err := parseAdmins(cfg.admins, moderators)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	store, err := newStorage(cfg, cfg.storage)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	key, err := spamKey(cfg.spamSecret)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	spamFilter, err := newSpamFilter(cfg, key, &model.SpamModel{DB: db})
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Load the message catalogs of every language from ui/locales...
+	bundle, err := i18n.Load(uiFS, "locales", cfg.lang)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
@@ -130,30 +360,76 @@ func main() {
 
 	// Initialize a new instance of our application struct, containing the dependencies.
 	app := &application{
+		config:         cfg,
 		infoLog:        infoLog,
 		errorLog:       errorLog,
 		blogs:          &model.BlogModel{DB: db},
-		templateCache:  templateCache,
+		translations:   &model.TranslationModel{DB: db},
+		comments:       &model.CommentModel{DB: db},
+		reactions:      &model.ReactionModel{DB: db},
+		media:          &model.MediaModel{DB: db},
+		series:         &model.SeriesModel{DB: db},
+		related:        &model.RelatedModel{DB: db},
+		pageViews:      &model.PageViewModel{DB: db},
+		visitorSalt:    &visitorSalt{},
+		uploads:        &uploadAllowance{},
+		storage:        store,
+		moderators:     moderators,
+		admins:         admins,
+		staff:          &model.StaffModel{DB: db},
+		sessions:       &model.SessionModel{DB: db},
+		db:             db,
+		started:        time.Now(),
+		spam:           spamFilter,
+		spamKey:        key,
+		themes:         themes,
+		siteThemes:     siteThemes,
+		i18n:           bundle,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
 	}
 
+	// Work out the related posts in the background, see related.go.
+	if cfg.relatedPosts > 0 {
+		app.relatedQueue = make(chan int, relatedQueueSize)
+		go app.relatedWorker()
+	}
+
+	// Write the page views in the background, see analytics.go.
+	if cfg.analytics {
+		app.views = make(chan model.PageView, viewQueueSize)
+		go app.viewWriter()
+	}
+
 	/*
 		set	the ErrorLog field so that the server now uses the custom errorLog logger in
 		the event of any problems.
 	*/
 	srv := http.Server{
-		Addr:     *addr,
+		Addr:     cfg.addr,
 		ErrorLog: errorLog,
 		Handler:  app.routes(),
 	}
 
+	if cfg.dev {
+		infoLog.Printf("Development mode, loading templates from %s", cfg.uiDir)
+	}
+
 	// Previously we done this in this way : log.Printf("Server running at PORT: %s \n", *addr)
-	infoLog.Printf("Server running at PORT: %s \n", *addr)
+	infoLog.Printf("Server running at PORT: %s \n", cfg.addr)
 	err = srv.ListenAndServe()
 	errorLog.Fatal(err)
 }
 
+// uiFiles() returns the ui file system: the embedded ui.Files, or the -ui-dir
+// folder when it was given.
+func uiFiles(cfg config) fs.FS {
+	if cfg.uiDir != "" {
+		return os.DirFS(cfg.uiDir)
+	}
+	return ui.Files
+}
+
 func openDB(dsn string) (*sql.DB, error) {
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
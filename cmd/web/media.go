@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/munnaMia/Story-Book/internal/media"
+	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/storage"
+	"github.com/munnaMia/Story-Book/internal/validator"
+)
+
+/*
+	Media
+	=====
+		Images can be uploaded with a new blog, or on their own in the media
+		library at /media-library, and a blog can use any image from the
+		library. internal/media checks and resizes the uploads, and the files
+		go into the storage picked with -storage: the -media-dir folder, or
+		an S3 bucket.
+
+		The files are served under /media/, like /media/3f9a.../w640.jpg.
+		The hash of the image is in the path, so a path always has the same
+		file and browsers can keep it forever. The uploads as they were sent
+		(with their EXIF data) are kept under originals/, which /media/
+		never serves.
+
+		With S3 storage /media/ doesn't send the file itself, it redirects
+		to a presigned URL of the bucket. The browser can also upload
+		straight into the bucket: /media-library/uploads hands out a
+		presigned URL for a key under incoming/, and once the file is there
+		/media-library/uploads/complete processes it like any other upload.
+		The bucket should have a lifecycle rule which expires incoming/
+		after a day, for uploads which are never completed.
+
+		The media library and the presigned upload URLs are only for the
+		moderators, otherwise anybody could use the storage to host their
+		files. Only they can pick images from the library on the create
+		page too. Everybody else's new blogs can still come with images
+		of their own, up to -visitor-uploads a day from one IP address,
+		and every upload counts against -media-quota, the size of the
+		whole library.
+*/
+
+// mediaPageSize is the number of images the media library shows on a page, and
+// the create page offers to reuse.
+const mediaPageSize = 24
+
+// mediaURLExpiry is how long the presigned URLs /media/ redirects to stay
+// valid, and mediaRedirectCache the Cache-Control of the redirect, which must
+// run out well before the URL does.
+const (
+	mediaURLExpiry     = time.Hour
+	mediaRedirectCache = "public, max-age=3000"
+)
+
+// shareImageWidth is the widest copy of an image used in share previews.
+// Facebook and Twitter want large images to be at least 1200 pixels wide.
+const shareImageWidth = 1280
+
+// uploadURLExpiry is how long a browser has to start a direct upload to the
+// bucket.
+const uploadURLExpiry = 15 * time.Minute
+
+// errUploadTooLarge is returned by saveUpload() for files bigger than the
+// -max-upload flag.
+var errUploadTooLarge = errors.New("upload too large")
+
+// errQuotaExceeded is returned by storeImage() when the media library has
+// reached -media-quota.
+var errQuotaExceeded = errors.New("media quota exceeded")
+
+// errVisitorQuota is returned by saveUpload() when a visitor has uploaded
+// -visitor-uploads today.
+var errVisitorQuota = errors.New("visitor upload quota exceeded")
+
+// uploadAllowance counts the bytes every IP address uploaded today (UTC), for
+// -visitor-uploads. It's only kept in memory, so a restart starts the day over.
+type uploadAllowance struct {
+	mu   sync.Mutex
+	day  string
+	used map[string]int64
+}
+
+// take() counts n more bytes for ip on day, and reports whether they still fit
+// under limit. Bytes which don't fit aren't counted.
+func (a *uploadAllowance) take(day, ip string, n, limit int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.day != day {
+		a.day = day
+		a.used = map[string]int64{}
+	}
+
+	if a.used[ip]+n > limit {
+		return false
+	}
+	a.used[ip] += n
+	return true
+}
+
+// mediaUploadForm is the form of the upload box of the media library.
+type mediaUploadForm struct {
+	validator.Validator `form:"-"`
+}
+
+// newStorage() returns a storage of the kind given, disk or s3, set up from the
+// flags.
+func newStorage(cfg config, kind string) (storage.Storage, error) {
+	switch kind {
+	case "disk":
+		return &storage.Disk{Root: cfg.mediaDir}, nil
+	case "s3":
+		if cfg.s3Bucket == "" {
+			return nil, errors.New("-s3-bucket is needed for s3 storage")
+		}
+		if cfg.s3AccessKey == "" || cfg.s3SecretKey == "" {
+			return nil, errors.New("-s3-access-key and -s3-secret-key are needed for s3 storage")
+		}
+
+		return &storage.S3{
+			Endpoint:  cfg.s3Endpoint,
+			Region:    cfg.s3Region,
+			Bucket:    cfg.s3Bucket,
+			Prefix:    cfg.s3Prefix,
+			AccessKey: cfg.s3AccessKey,
+			SecretKey: cfg.s3SecretKey,
+			PathStyle: cfg.s3PathStyle,
+			// Every key we store is named after the hash of its
+			// content, so the files never change.
+			CacheControl: "public, max-age=31536000, immutable",
+			Client:       &http.Client{Timeout: 5 * time.Minute},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q, want disk or s3", kind)
+	}
+}
+
+// storageOrigins() returns the origins pages load files from when they're in
+// object storage: the bucket /media/ redirects to, and the -static-url.
+func (app *application) storageOrigins() []string {
+	var origins []string
+
+	if s3, ok := app.storage.(*storage.S3); ok {
+		origins = append(origins, s3.Origin())
+	}
+	if u, err := url.Parse(app.config.staticURL); err == nil && u.Host != "" {
+		origins = append(origins, u.Scheme+"://"+u.Host)
+	}
+
+	return origins
+}
+
+// mediaURL() returns the URL of the file of m which fits width pixels best: the
+// smallest resized copy which is at least that wide, or the whole image.
+// A width of 0 always gives the whole image.
+func mediaURL(m *model.Media, width int) string {
+	if width > 0 {
+		for _, w := range media.VariantWidths(m.Width) {
+			if w >= width {
+				return "/media/" + media.Key(m.Hash, m.ContentType, w)
+			}
+		}
+	}
+	return "/media/" + media.Key(m.Hash, m.ContentType, 0)
+}
+
+// srcset() returns the srcset attribute of an image: the URL of every resized
+// copy and of the whole image, each with its width. The browser picks the
+// smallest one which is sharp at the size the sizes attribute of the <img>
+// says it's shown at.
+func srcset(m *model.Media) string {
+	var parts []string
+	for _, w := range media.VariantWidths(m.Width) {
+		parts = append(parts, fmt.Sprintf("%s %dw", mediaURL(m, w), w))
+	}
+	parts = append(parts, fmt.Sprintf("%s %dw", mediaURL(m, 0), m.Width))
+	return strings.Join(parts, ", ")
+}
+
+// setShareImage() makes m the image of the share preview of a page.
+func (app *application) setShareImage(r *http.Request, meta *pageMeta, m *model.Media, alt string) {
+	width := min(m.Width, shareImageWidth)
+
+	meta.Image = app.absoluteURL(r, mediaURL(m, width))
+	meta.ImageWidth = width
+	meta.ImageHeight = m.Height * width / m.Width
+	meta.ImageAlt = alt
+}
+
+// fileSize() returns a size in bytes the way people read it, like "1.4 MB".
+func fileSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// parseUploadForm() reads a multipart form, refusing bodies larger than the
+// uploads we accept. A form without files (sent as a normal form) is fine.
+func (app *application) parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	// Room for a few files of the largest size, and the rest of the form.
+	r.Body = http.MaxBytesReader(w, r.Body, 4*app.config.maxUpload+(1<<20))
+
+	err := r.ParseMultipartForm(8 << 20)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	return nil
+}
+
+// uploadError() maps the error of saveUpload() to a validation message, or
+// returns "" when it isn't the uploader's fault.
+func uploadError(err error) string {
+	switch {
+	case errors.Is(err, media.ErrUnsupported):
+		return "validation.image_type"
+	case errors.Is(err, media.ErrTooLarge), errors.Is(err, errUploadTooLarge):
+		return "validation.image_size"
+	case errors.Is(err, errQuotaExceeded):
+		return "validation.media_quota"
+	case errors.Is(err, errVisitorQuota):
+		return "validation.visitor_uploads"
+	default:
+		return ""
+	}
+}
+
+// saveUpload() reads an uploaded image and passes it on to storeImage().
+func (app *application) saveUpload(r *http.Request, fh *multipart.FileHeader) (*model.Media, error) {
+	if fh.Size > app.config.maxUpload {
+		return nil, errUploadTooLarge
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Read one byte more than we accept, to notice a file which is bigger
+	// than its header said.
+	data, err := io.ReadAll(io.LimitReader(f, app.config.maxUpload+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > app.config.maxUpload {
+		return nil, errUploadTooLarge
+	}
+
+	// Moderators upload as much as they like, within -media-quota.
+	if app.config.visitorUploads > 0 && app.moderator(r) == "" {
+		day := time.Now().UTC().Format(time.DateOnly)
+		if !app.uploads.take(day, hostname(r.RemoteAddr), int64(len(data)), app.config.visitorUploads) {
+			return nil, errVisitorQuota
+		}
+	}
+
+	return app.storeImage(r.Context(), fh.Filename, data)
+}
+
+// storeImage() processes an image, stores its files and adds it to the media
+// library under name.
+func (app *application) storeImage(ctx context.Context, name string, data []byte) (*model.Media, error) {
+	if app.config.mediaQuota > 0 {
+		total, err := app.media.TotalSize()
+		if err != nil {
+			return nil, err
+		}
+		if total+int64(len(data)) > app.config.mediaQuota {
+			return nil, errQuotaExceeded
+		}
+	}
+
+	img, err := media.Process(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range img.Files {
+		err := app.storage.Put(ctx, file.Key, bytes.NewReader(file.Data), int64(len(file.Data)), file.ContentType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return app.media.Insert(&model.Media{
+		Hash:        img.Hash,
+		Name:        name,
+		ContentType: img.ContentType,
+		Width:       img.Width,
+		Height:      img.Height,
+		Size:        int64(len(data)),
+	})
+}
+
+// saveUploads() saves every file of the field of a multipart form. Problems
+// with the files are added to the validator as errors of the field.
+func (app *application) saveUploads(r *http.Request, field string, v *validator.Validator) ([]*model.Media, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+
+	var saved []*model.Media
+
+	for _, fh := range r.MultipartForm.File[field] {
+		m, err := app.saveUpload(r, fh)
+		if err != nil {
+			if key := uploadError(err); key != "" {
+				v.AddFieldError(field, key, fh.Filename, app.config.maxUpload>>20)
+				continue
+			}
+			return nil, err
+		}
+		saved = append(saved, m)
+	}
+
+	return saved, nil
+}
+
+func (app *application) mediaFile(w http.ResponseWriter, r *http.Request) {
+	param := httprouter.ParamsFromContext(r.Context())
+	key := strings.TrimPrefix(param.ByName("filepath"), "/")
+
+	if !storage.ValidKey(key) || strings.HasPrefix(key, "originals/") || strings.HasPrefix(key, "incoming/") {
+		app.notFound(w, r)
+		return
+	}
+
+	// A store which can presign URLs serves the file itself. We don't ask
+	// the store whether the key is there, a missing one gets its 404 from
+	// the store.
+	if p, ok := app.storage.(storage.Presigner); ok {
+		signed, err := p.PresignGet(key, mediaURLExpiry)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", mediaRedirectCache)
+		http.Redirect(w, r, signed, http.StatusFound)
+		return
+	}
+
+	obj, err := app.storage.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer obj.Body.Close()
+
+	// The path of a media file has the hash of the image in it, so the file
+	// behind a path never changes and can be cached for good. This is only
+	// set here, a 404 must not be cached like that.
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	if obj.ContentType != "" {
+		w.Header().Set("Content-Type", obj.ContentType)
+	}
+
+	// http.ServeContent() handles If-Modified-Since and range requests, but
+	// it needs to seek in the file. Stores which can't just send it all.
+	if rs, ok := obj.Body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, obj.Modified, rs)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	io.Copy(w, obj.Body)
+}
+
+func (app *application) mediaLibrary(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			app.notFound(w, r)
+			return
+		}
+		page = n
+	}
+
+	app.showMediaLibrary(w, r, http.StatusOK, page, mediaUploadForm{})
+}
+
+// showMediaLibrary() renders a page of the media library, with the form of the
+// upload box.
+func (app *application) showMediaLibrary(w http.ResponseWriter, r *http.Request, status, page int, form mediaUploadForm) {
+	list, err := app.media.Page(mediaPageSize, (page-1)*mediaPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	total, err := app.media.Count()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Media = list
+	data.Form = form
+	data.Page = page
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*mediaPageSize < total {
+		data.NextPage = page + 1
+	}
+
+	app.render(w, r, status, "media.html", data)
+}
+
+func (app *application) mediaUploadPost(w http.ResponseWriter, r *http.Request) {
+	err := app.parseUploadForm(w, r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.clientError(w, r, http.StatusRequestEntityTooLarge)
+		} else {
+			app.clientError(w, r, http.StatusBadRequest)
+		}
+		return
+	}
+
+	var form mediaUploadForm
+	form.T = app.localizer(r).T
+
+	if r.MultipartForm == nil || len(r.MultipartForm.File["images"]) == 0 {
+		form.AddFieldError("images", "validation.image_missing")
+	}
+
+	var saved []*model.Media
+	if form.Valid() {
+		saved, err = app.saveUploads(r, "images", &form.Validator)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.showMediaLibrary(w, r, http.StatusUnprocessableEntity, 1, form)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T("flash.media_uploaded", len(saved)))
+
+	http.Redirect(w, r, "/media-library", http.StatusSeeOther)
+}
+
+// presignedUpload is the answer of mediaUploadURL.
+type presignedUpload struct {
+	Key     string    `json:"key"`
+	URL     string    `json:"url"`
+	Method  string    `json:"method"`
+	Expires time.Time `json:"expires"`
+}
+
+// uploadedMedia is the answer of mediaUploadComplete.
+type uploadedMedia struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// incomingKey() reports whether key is one mediaUploadURL could have handed
+// out: incoming/ and 32 hex digits.
+func incomingKey(key string) bool {
+	id, ok := strings.CutPrefix(key, "incoming/")
+	if !ok || len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// mediaUploadURL hands out a presigned URL a browser can PUT one image to. It's
+// a 404 when the storage can't presign URLs, and the browser uploads to
+// /media-library instead.
+func (app *application) mediaUploadURL(w http.ResponseWriter, r *http.Request) {
+	p, ok := app.storage.(storage.Presigner)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	key := "incoming/" + hex.EncodeToString(b)
+
+	signed, err := p.PresignPut(key, uploadURLExpiry)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, presignedUpload{
+		Key:     key,
+		URL:     signed,
+		Method:  http.MethodPut,
+		Expires: time.Now().Add(uploadURLExpiry).UTC(),
+	})
+}
+
+// mediaUploadComplete processes an image the browser uploaded to the key it got
+// from mediaUploadURL. The file under incoming/ is deleted afterwards, whether
+// it was an image we accept or not.
+func (app *application) mediaUploadComplete(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	key := r.PostForm.Get("key")
+	name := r.PostForm.Get("name")
+	if !incomingKey(key) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	if name == "" {
+		name = path.Base(key)
+	}
+
+	obj, err := app.storage.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Nothing stopped the browser from uploading more than we accept, so
+	// the size is checked here.
+	data, err := io.ReadAll(io.LimitReader(obj.Body, app.config.maxUpload+1))
+	obj.Body.Close()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var saved *model.Media
+	if int64(len(data)) > app.config.maxUpload {
+		err = errUploadTooLarge
+	} else {
+		saved, err = app.storeImage(r.Context(), name, data)
+	}
+
+	if derr := app.storage.Delete(r.Context(), key); derr != nil && !errors.Is(derr, storage.ErrNotExist) {
+		app.errorLog.Print(derr)
+	}
+
+	if err != nil {
+		if message := uploadError(err); message != "" {
+			app.writeJSON(w, r, http.StatusUnprocessableEntity, map[string]any{
+				"status":  http.StatusUnprocessableEntity,
+				"error":   http.StatusText(http.StatusUnprocessableEntity),
+				"message": app.localizer(r).T(message, name, app.config.maxUpload>>20),
+			})
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, uploadedMedia{ID: saved.ID, Name: saved.Name, URL: mediaURL(saved, 0)})
+}
@@ -1,20 +1,37 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/munnaMia/Story-Book/internal/i18n"
 )
 
-func secureHeaders(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
-		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "deny")
-		w.Header().Set("X-XSS-Protection", "0")
+// secureHeaders() returns the middleware which sets the security headers. The
+// origins are allowed next to 'self' as the source of anything a page loads.
+func secureHeaders(origins ...string) func(http.Handler) http.Handler {
+	sources := strings.Join(append([]string{"'self'"}, origins...), " ")
+	csp := fmt.Sprintf("default-src %[1]s; style-src %[1]s fonts.googleapis.com; font-src fonts.gstatic.com", sources)
 
-		next.ServeHTTP(w, r)
-	})
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Security-Policy", csp)
+			w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("X-Frame-Options", "deny")
+			w.Header().Set("X-XSS-Protection", "0")
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func (app *application) logRequest(next http.Handler) http.Handler {
@@ -34,10 +51,272 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 			// panic or not. If there has...
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// cacheControl() returns a middleware which sets the Cache-Control header to
+// the given value, so every route can say how long it may be cached for.
+func cacheControl(value string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", value)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+	Cross-site requests
+	===================
+		The moderators log in with HTTP basic authentication, and the
+		browser sends the name and password with every request to the site,
+		also with a form another site posts here. preventCSRF turns down
+		any POST (PUT, DELETE...) which another site made the browser send:
+
+			- Browsers say where a request comes from in Sec-Fetch-Site.
+			  Only "same-origin" and "none" (typed into the address bar or
+			  a bookmark) are let through.
+			- Older browsers don't send Sec-Fetch-Site, but they do send the
+			  Origin of a form post, which must be our own host.
+			- A request with neither header doesn't come from a browser at
+			  all, so there is nothing to forge and it's let through.
+
+		The session cookie is SameSite=Lax, so it was never sent with a post
+		from another site, but the password of basic authentication is.
+
+		The pages of the moderators (the moderation queue, the series, the
+		media library and the admin dashboard) change more than anybody
+		else's, so their forms carry a token as well, which doesn't lean on
+		what the browser sends. csrfToken() keeps a random token in the
+		session, the forms send it back in the hidden csrf_token field (see
+		partials/csrf.html) and main.js in the X-CSRF-Token header, and
+		requireCSRFToken turns down any post to the moderators' routes
+		without it. Another site can't read our pages, so it can't know the
+		token.
+*/
+
+func (app *application) preventCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+			if site != "same-origin" && site != "none" {
+				app.clientError(w, r, http.StatusForbidden)
+				return
+			}
+		} else if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !strings.EqualFold(u.Host, r.Host) {
+				app.clientError(w, r, http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfToken() returns the CSRF token of the session, and makes one the first
+// time it's asked for.
+func (app *application) csrfToken(r *http.Request) string {
+	token := app.sessionManager.GetString(r.Context(), "csrfToken")
+	if token != "" {
+		return token
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	app.sessionManager.Put(r.Context(), "csrfToken", token)
+	return token
+}
+
+func (app *application) requireCSRFToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sent := r.Header.Get("X-CSRF-Token")
+		if sent == "" {
+			// The media library posts multipart forms, so the form is
+			// read with the limits of an upload. The handlers find it
+			// already parsed.
+			err := app.parseUploadForm(w, r)
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+				if errors.As(err, &maxBytesError) {
+					app.clientError(w, r, http.StatusRequestEntityTooLarge)
+				} else {
+					app.clientError(w, r, http.StatusBadRequest)
+				}
+				return
+			}
+			sent = r.PostForm.Get("csrf_token")
+		}
+
+		want := app.sessionManager.GetString(r.Context(), "csrfToken")
+		if want == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(want)) != 1 {
+			app.clientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+	Locale negotiation
+	==================
+		negotiateLocale picks the language of the request and stores its
+		i18n.Localizer in the request context. In order:
+
+			1. the "lang" cookie, which the language switcher in the nav sets
+			   and which is the visitor's saved preference,
+			2. the languages of the browser's Accept-Language header,
+			3. the default language from the -lang flag.
+
+		The timezone dates are shown in comes from the "tz" cookie. It's set
+		on the preferences page, or by main.js from the browser's own
+		timezone the first time somebody visits. Without it dates are UTC.
+
+		Only the pages and error pages are in the visitor's language, so
+		only they get the Vary and Content-Language headers, see
+		localized(). Static files, media and feeds are the same for
+		everybody, and caches keep a single copy of them.
+*/
+
+func (app *application) negotiateLocale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var preferred []string
+
+		if cookie, err := r.Cookie("lang"); err == nil {
+			preferred = append(preferred, cookie.Value)
+		}
+		preferred = append(preferred, i18n.ParseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+
+		loc := app.i18n.Localizer(app.i18n.Match(preferred...))
+
+		if cookie, err := r.Cookie("tz"); err == nil {
+			if tz, err := time.LoadLocation(cookie.Value); err == nil {
+				loc.Location = tz
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), localizerContextKey, loc)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+/*
+	Moderators
+	==========
+		requireModerator only lets the moderators from the -moderators flag
+		through. The browser asks for the name and password (HTTP basic
+		authentication) and sends them with every request after that, so
+		the site must be served over HTTPS for this to be safe.
+
+		The passwords are compared with subtle.ConstantTimeCompare(), which
+		takes the same time whether the first or the last character is
+		wrong, so the time of a response doesn't give the password away.
+
+		A moderator the admins disabled on the dashboard (see admin.go) gets
+		a 403 Forbidden, even with the right password. requireAdmin comes
+		after requireModerator and only lets the admins through.
+
+		identifyModerator is for pages which are open to everybody but
+		offer the moderators more, like the create page. It never asks
+		for a password, but when the browser sends the one of an enabled
+		moderator (it does on the whole site, once the moderator logged in)
+		the request is theirs like behind requireModerator.
+*/
+
+// basicAuthModerator() returns the name of the moderator whose name and
+// password the request has, or "" when it has none or they're wrong.
+func (app *application) basicAuthModerator(r *http.Request) string {
+	name, password, ok := r.BasicAuth()
+
+	want, known := app.moderators[name]
+	if !ok || !known || subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 {
+		return ""
+	}
+	return name
+}
+
+func (app *application) requireModerator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := app.basicAuthModerator(r)
+		if name == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="moderation", charset="UTF-8"`)
+			app.clientError(w, r, http.StatusUnauthorized)
+			return
+		}
+
+		staff, err := app.staff.Get(name)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if staff.Disabled && !app.admins[name] {
+			app.clientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), moderatorContextKey, name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *application) identifyModerator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := app.basicAuthModerator(r)
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		staff, err := app.staff.Get(name)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if staff.Disabled && !app.admins[name] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), moderatorContextKey, name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin, err := app.isAdmin(app.moderator(r))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if !admin {
+			app.clientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+/*
+	Reactions
+	=========
+		The buttons under a blog post to /blog/view/:id/reactions, which
+		adds the visitor's reaction or takes it away when they click the
+		same one again. /blog/view/:id/reactions answers GET requests with
+		the counts as JSON:
+
+			{"blog_id": 7, "counts": {"like": 3, "love": 1, ...}, "mine": ["like"]}
+
+		We don't have user accounts, so a visitor is a random ID kept in
+		their session. The blog page itself is cached for everybody, so it
+		only shows the counts; main.js asks for "mine" to highlight the
+		visitor's own reactions, and sends the clicks without reloading the
+		page.
+
+		The ID is handed out by that GET, never by a click: a click without
+		a session (curl in a loop, say) only starts one, and the visitor has
+		to click again. A visitor who makes a new session for every click
+		is still only counted once a day, by the hash of their IP address
+		and User-Agent, see ReactionModel.Toggle(). The salt of that hash
+		isn't saved (see analytics.go), so after a restart the visitor can
+		be counted once more that day.
+*/
+
+// reactionKind is a kind of reaction and the emoji of its button.
+type reactionKind struct {
+	Name  string
+	Emoji string
+}
+
+// reactionKinds are the reactions a blog can get, in the order of the buttons.
+var reactionKinds = []reactionKind{
+	{"like", "👍"},
+	{"love", "❤️"},
+	{"laugh", "😂"},
+	{"wow", "😮"},
+	{"sad", "😢"},
+}
+
+// reaction is a reaction button, or a count on the home page.
+type reaction struct {
+	Kind  string
+	Emoji string
+	Count int
+}
+
+// reactionForm is the form of the reaction buttons.
+type reactionForm struct {
+	Reaction string `form:"reaction"`
+}
+
+// reactionsResponse is the JSON of the reactions endpoint.
+type reactionsResponse struct {
+	BlogID int            `json:"blog_id"`
+	Counts map[string]int `json:"counts"`
+	Mine   []string       `json:"mine"`
+}
+
+// reactionList() turns the counts of a blog into the list of its reactions,
+// in the order of reactionKinds. With all it includes the kinds nobody
+// reacted with, for the buttons.
+func reactionList(counts map[string]int, all bool) []reaction {
+	list := []reaction{}
+	for _, k := range reactionKinds {
+		if all || counts[k.Name] > 0 {
+			list = append(list, reaction{Kind: k.Name, Emoji: k.Emoji, Count: counts[k.Name]})
+		}
+	}
+	return list
+}
+
+// visitorID() returns the random ID of the visitor, which is kept in their
+// session. A visitor without one gets a new one.
+func (app *application) visitorID(r *http.Request) (string, error) {
+	id := app.sessionManager.GetString(r.Context(), "visitor")
+	if id != "" {
+		return id, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id = hex.EncodeToString(b)
+
+	app.sessionManager.Put(r.Context(), "visitor", id)
+	return id, nil
+}
+
+// fingerprint() returns the daily hash of the IP address and User-Agent of the
+// request, the same one the page views are counted with.
+func (app *application) fingerprint(r *http.Request) string {
+	day := time.Now().UTC().Format(time.DateOnly)
+	return app.visitorSalt.hash(day, hostname(r.RemoteAddr), r.UserAgent())
+}
+
+func (app *application) blogReactions(w http.ResponseWriter, r *http.Request) {
+	blog := app.blogFromParam(w, r)
+	if blog == nil {
+		return
+	}
+
+	// Give the visitor their ID now, so their clicks count.
+	if _, err := app.visitorID(r); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeReactions(w, r, blog.ID)
+}
+
+func (app *application) blogReactPost(w http.ResponseWriter, r *http.Request) {
+	blog := app.blogFromParam(w, r)
+	if blog == nil {
+		return
+	}
+
+	var form reactionForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || !slices.ContainsFunc(reactionKinds, func(k reactionKind) bool { return k.Name == form.Reaction }) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	// A click without a session only starts one, see the top of the file.
+	visitor := app.sessionManager.GetString(r.Context(), "visitor")
+	if visitor == "" {
+		if _, err := app.visitorID(r); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if !wantsJSON(r) {
+			app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T("flash.reaction_again"))
+		}
+	} else {
+		_, err = app.reactions.Toggle(blog.ID, visitor, app.fingerprint(r), form.Reaction)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// main.js wants the new counts, a plain form post goes back to the page.
+	if wantsJSON(r) {
+		app.writeReactions(w, r, blog.ID)
+		return
+	}
+
+	back := localPath(r.Referer(), fmt.Sprintf("/blog/view/%d", blog.ID))
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// writeReactions() sends the reaction counts of a blog as JSON, together with
+// the reactions of the visitor.
+func (app *application) writeReactions(w http.ResponseWriter, r *http.Request, blogID int) {
+	counts, err := app.reactions.Counts(blogID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Every kind is in the counts, so the buttons don't need to know which
+	// ones nobody used yet.
+	for _, k := range reactionKinds {
+		if _, ok := counts[k.Name]; !ok {
+			counts[k.Name] = 0
+		}
+	}
+
+	mine := []string{}
+	if visitor := app.sessionManager.GetString(r.Context(), "visitor"); visitor != "" {
+		mine, err = app.reactions.Mine(blogID, visitor)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	js, err := json.Marshal(reactionsResponse{BlogID: blogID, Counts: counts, Mine: mine})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(js)
+}
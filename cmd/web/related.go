@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/related"
+)
+
+/*
+	Related posts
+	=============
+		The bottom of every blog page lists the -related-posts blogs most like
+		it, by their words and their tags (see internal/related for the
+		score). Working them out needs every blog, which is too slow for a
+		page view, so it's done in the background and kept in the
+		related_blogs table:
+
+			- relatedWorker() runs in its own goroutine for as long as the
+			  server runs. It fills the table from scratch when it starts,
+			  which also drops blogs which expired since the last time.
+			- queueRelated() is called when a blog is created (or changed).
+			  The worker updates the list of that blog, and the lists of the
+			  other blogs it now belongs in.
+
+		A blog page shown before the worker got to it has no related posts
+		yet, they're there on the next visit.
+*/
+
+// relatedQueueSize is how many blogs can wait for the worker. It's only full
+// when blogs come in faster than the worker keeps up, and a blog which doesn't
+// fit is picked up by the next full rebuild.
+const relatedQueueSize = 100
+
+// maxTags is the most tags a blog can have.
+const maxTags = 10
+
+// parseTags() turns the comma separated tags of a form into slugs, without
+// duplicates: "Go, Web Development, go" gives [go web-development].
+func parseTags(s string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+
+	for _, field := range strings.Split(s, ",") {
+		tag := slugify(field)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// queueRelated() asks the worker to update the related posts of a blog. It
+// never waits, a full queue only means the blog is left for the next rebuild.
+func (app *application) queueRelated(blogID int) {
+	if app.relatedQueue == nil {
+		return
+	}
+
+	select {
+	case app.relatedQueue <- blogID:
+	default:
+		app.errorLog.Printf("Related posts queue is full, blog %d waits for the next rebuild", blogID)
+	}
+}
+
+// relatedWorker() fills the related_blogs table when it starts, then updates
+// it for every blog sent to app.relatedQueue.
+func (app *application) relatedWorker() {
+	app.runRelated(func() error {
+		return rebuildRelated(app.related, app.config.relatedPosts)
+	})
+
+	for id := range app.relatedQueue {
+		// Blogs which came in while the last one was worked on are done
+		// together, the index is built only once for all of them.
+		ids := []int{id}
+	drain:
+		for {
+			select {
+			case id := <-app.relatedQueue:
+				ids = append(ids, id)
+			default:
+				break drain
+			}
+		}
+
+		app.runRelated(func() error {
+			return updateRelated(app.related, app.config.relatedPosts, ids)
+		})
+	}
+}
+
+// runRelated() runs a job of the worker and logs its error. There's no
+// recoverPanic middleware around the worker, so a panic is caught here too,
+// it would stop the whole server otherwise.
+func (app *application) runRelated(job func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.errorLog.Printf("Related posts: %s", err)
+		}
+	}()
+
+	if err := job(); err != nil {
+		app.errorLog.Printf("Related posts: %s", err)
+	}
+}
+
+// rebuildRelated() works out the related posts of every blog again.
+func rebuildRelated(m *model.RelatedModel, limit int) error {
+	docs, err := m.Docs()
+	if err != nil {
+		return err
+	}
+
+	ix := related.NewIndex(docs)
+
+	for _, doc := range docs {
+		if err := m.Set(doc.ID, ix.Similar(doc.ID, limit)); err != nil {
+			return fmt.Errorf("blog %d: %w", doc.ID, err)
+		}
+	}
+	return nil
+}
+
+// updateRelated() updates the related posts of the blogs ids, and of the blogs
+// they're related to. Only the lists which change are written.
+func updateRelated(m *model.RelatedModel, limit int, ids []int) error {
+	docs, err := m.Docs()
+	if err != nil {
+		return err
+	}
+
+	current, err := m.All()
+	if err != nil {
+		return err
+	}
+
+	ix := related.NewIndex(docs)
+
+	for _, id := range ids {
+		for blogID, matches := range ix.Update(id, current, limit) {
+			if err := m.Set(blogID, matches); err != nil {
+				return fmt.Errorf("blog %d: %w", blogID, err)
+			}
+			current[blogID] = matches
+		}
+	}
+	return nil
+}
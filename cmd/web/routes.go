@@ -13,24 +13,104 @@ func (app *application) routes() http.Handler {
 
 	// Handle 404 not found.
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.notFound(w)
+		app.notFound(w, r)
 	})
 
 	//create a fileserver. for serving static files as a http handler form the root of the application.
-	fileserver := http.FileServer(http.Dir("./ui/static/"))
-	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileserver))
+	// Every theme has its own static files, so staticFile() hands the request
+	// to the file server of the request's theme.
+	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", http.HandlerFunc(app.staticFile)))
 
 	// Create a new middleware chain containing the middleware specific to our
 	// dynamic application routes. For now, this chain will only contain the
 	// LoadAndSave session middleware but we'll add more to it later.
-	dynamic := alice.New(app.sessionManager.LoadAndSave)
+	// preventCSRF turns down forms posted from other sites, see middleware.go.
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.preventCSRF)
 
-	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
-	router.Handler(http.MethodGet, "/blog/view/:id", dynamic.ThenFunc(app.blogView))
-	router.Handler(http.MethodGet, "/blog/create", dynamic.ThenFunc(app.blogCreate))
-	router.Handler(http.MethodPost, "/blog/create", dynamic.ThenFunc(app.blogCreatePost))
+	// Public pages can be cached for a short while but must be revalidated
+	// (with the ETag from render()) after that. The create form is only for
+	// the person filling it in, so it's never stored.
+	// The views of the pages people read are counted, see analytics.go.
+	pages := dynamic.Append(app.countView)
 
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	router.Handler(http.MethodGet, "/", pages.Append(cacheControl("public, max-age=60")).ThenFunc(app.home))
+	router.Handler(http.MethodGet, "/blog/view/:id", pages.Append(cacheControl("public, max-age=300")).ThenFunc(app.blogView))
+	// Anybody can write a blog, but only moderators can put it into a series
+	// somebody else started, see identifyModerator.
+	router.Handler(http.MethodGet, "/blog/create", dynamic.Append(cacheControl("private, no-store"), app.identifyModerator).ThenFunc(app.blogCreate))
+	router.Handler(http.MethodPost, "/blog/create", dynamic.Append(cacheControl("private, no-store"), app.identifyModerator).ThenFunc(app.blogCreatePost))
+	router.Handler(http.MethodGet, "/blog/view/:id/translate", dynamic.Append(cacheControl("private, no-store")).ThenFunc(app.blogTranslate))
+	router.Handler(http.MethodPost, "/blog/view/:id/translate", dynamic.Append(cacheControl("private, no-store")).ThenFunc(app.blogTranslatePost))
+	router.Handler(http.MethodPost, "/blog/view/:id/comments", dynamic.Append(cacheControl("private, no-store")).ThenFunc(app.blogCommentPost))
+	router.Handler(http.MethodGet, "/blog/view/:id/reactions", dynamic.Append(cacheControl("private, no-store")).ThenFunc(app.blogReactions))
+	router.Handler(http.MethodPost, "/blog/view/:id/reactions", dynamic.Append(cacheControl("private, no-store")).ThenFunc(app.blogReactPost))
+
+	// Translations live under their language code, like /bn/blog/amar-golpo.
+	// httprouter can't have a :lang parameter next to the other routes at
+	// the root, so every language gets its own route.
+	for _, lang := range app.i18n.Languages() {
+		router.Handler(http.MethodGet, "/"+lang+"/blog/:slug", pages.Append(cacheControl("public, max-age=300")).ThenFunc(app.blogTranslationView(lang)))
+	}
+
+	router.Handler(http.MethodGet, "/series/:slug", pages.Append(cacheControl("public, max-age=300")).ThenFunc(app.seriesView))
+
+	router.Handler(http.MethodPost, "/locale", dynamic.Append(cacheControl("private, no-store")).ThenFunc(app.localeSet))
+	router.Handler(http.MethodGet, "/preferences", dynamic.Append(cacheControl("private, no-store")).ThenFunc(app.preferences))
+	router.Handler(http.MethodPost, "/preferences", dynamic.Append(cacheControl("private, no-store")).ThenFunc(app.preferencesPost))
+
+	// The moderation queue is only for the moderators, see requireModerator.
+	// Their forms must send the CSRF token of the session, see middleware.go.
+	moderators := dynamic.Append(cacheControl("private, no-store"), app.requireModerator, app.requireCSRFToken)
+
+	router.Handler(http.MethodGet, "/moderation", moderators.ThenFunc(app.moderation))
+	router.Handler(http.MethodPost, "/moderation/comments/:id", moderators.ThenFunc(app.moderationPost))
+
+	// The admin dashboard is only for the admins among the moderators, see
+	// admin.go. The page view dashboard is in analytics.go.
+	admins := moderators.Append(app.requireAdmin)
+
+	router.Handler(http.MethodGet, "/admin", admins.ThenFunc(app.admin))
+	router.Handler(http.MethodGet, "/admin/blogs", admins.ThenFunc(app.adminBlogs))
+	router.Handler(http.MethodPost, "/admin/blogs", admins.ThenFunc(app.adminBlogsPost))
+	router.Handler(http.MethodGet, "/admin/users", admins.ThenFunc(app.adminUsers))
+	router.Handler(http.MethodPost, "/admin/users/:name", admins.ThenFunc(app.adminUserPost))
+	router.Handler(http.MethodGet, "/admin/stats", admins.ThenFunc(app.adminStats))
+
+	// Series hold the blogs of other people too, so only the moderators can
+	// change them once they're made.
+	router.Handler(http.MethodGet, "/series/:slug/edit", moderators.ThenFunc(app.seriesEdit))
+	router.Handler(http.MethodPost, "/series/:slug/edit", moderators.ThenFunc(app.seriesEditPost))
+
+	// The media library hands out storage, so it's only for the moderators
+	// as well, see media.go.
+	router.Handler(http.MethodGet, "/media-library", moderators.ThenFunc(app.mediaLibrary))
+	router.Handler(http.MethodPost, "/media-library", moderators.ThenFunc(app.mediaUploadPost))
+	router.Handler(http.MethodPost, "/media-library/uploads", moderators.ThenFunc(app.mediaUploadURL))
+	router.Handler(http.MethodPost, "/media-library/uploads/complete", moderators.ThenFunc(app.mediaUploadComplete))
+
+	// The feed, sitemap and robots.txt don't need the session, so they're not
+	// wrapped in the dynamic chain.
+	feeds := alice.New(cacheControl("public, max-age=3600"))
+
+	router.Handler(http.MethodGet, "/feed.json", feeds.ThenFunc(app.feedJSON))
+	router.Handler(http.MethodGet, "/sitemap.xml", feeds.ThenFunc(app.sitemap))
+	router.Handler(http.MethodGet, "/sitemaps/:file", feeds.ThenFunc(app.sitemapPage))
+	router.Handler(http.MethodGet, "/robots.txt", feeds.ThenFunc(app.robots))
+
+	// A fresh form stamp for the comment forms of the cached blog pages,
+	// see spam.go. It must never be cached.
+	router.Handler(http.MethodGet, "/form-stamp", alice.New(cacheControl("private, no-store")).ThenFunc(app.formStampGet))
+
+	// Uploaded images, see media.go.
+	router.HandlerFunc(http.MethodGet, "/media/*filepath", app.mediaFile)
+
+	// compress is the last middleware in the chain so that it wraps the
+	// response writer of every handler, including the static file server.
+	// negotiateLocale is in the standard chain, so even error pages from the
+	// router are shown in the visitor's language.
+	// secureHeaders has to let the pages use the origins of the object
+	// storage, which the images and static files may come from.
+	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders(app.storageOrigins()...), app.negotiateLocale, app.compress)
 
 	return standard.Then(router)
 }
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/summary"
+	"github.com/munnaMia/Story-Book/internal/validator"
+)
+
+/*
+	Series
+	======
+		A series is an ordered group of blogs, like the parts of a
+		tutorial. A blog is added to a series when it's created: anybody
+		can start a new one on the spot, and the moderators can also pick
+		an old one. Every blog of a series shows the table of contents of
+		the series with links to the parts before and after it.
+
+			/series/go-from-scratch         the index page of the series
+			/series/go-from-scratch/edit    rename it, reorder, add and
+			                                remove blogs (moderators only)
+
+		The slug of a series is made from its title when it's created, and
+		stays the same when the title changes, so links keep working.
+*/
+
+// seriesEditForm is the form of the edit page of a series. Blogs and Positions
+// go together: the blog Blogs[i] should become part Positions[i].
+type seriesEditForm struct {
+	Title               string `form:"title"`
+	Description         string `form:"description"`
+	Blogs               []int  `form:"blogs"`
+	Positions           []int  `form:"positions"`
+	Remove              []int  `form:"remove"`
+	Add                 int    `form:"add"`
+	validator.Validator `form:"-"`
+}
+
+// slugify() makes a slug from a title: the letters and digits in lower case,
+// with a dash between the words. Letters of any alphabet are kept, so Bengali
+// titles give Bengali slugs.
+func slugify(title string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
+// seriesPath() returns the path of the index page of a series.
+func seriesPath(s *model.Series) string {
+	return "/series/" + s.Slug
+}
+
+// seriesNeighbours() returns the part number of the blog in the series, and
+// the blogs before and after it. The part is 0 when the blog isn't one of the
+// blogs of the series.
+func seriesNeighbours(s *model.Series, blogID int) (part int, prev, next *model.Blog) {
+	i := slices.IndexFunc(s.Blogs, func(b *model.Blog) bool { return b.ID == blogID })
+	if i < 0 {
+		return 0, nil, nil
+	}
+
+	if i > 0 {
+		prev = s.Blogs[i-1]
+	}
+	if i < len(s.Blogs)-1 {
+		next = s.Blogs[i+1]
+	}
+	return i + 1, prev, next
+}
+
+// seriesFromPath() returns the series named by the :slug of the request. It
+// sends the error response itself and returns nil when there isn't one.
+func (app *application) seriesFromPath(w http.ResponseWriter, r *http.Request) *model.Series {
+	param := httprouter.ParamsFromContext(r.Context())
+
+	series, err := app.series.GetBySlug(param.ByName("slug"))
+	if err != nil {
+		if errors.Is(err, model.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+	return series
+}
+
+func (app *application) seriesView(w http.ResponseWriter, r *http.Request) {
+	series := app.seriesFromPath(w, r)
+	if series == nil {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Series = series
+	data.Meta.Title = series.Title
+	if series.Description != "" {
+		data.Meta.Description = summary.Excerpt(series.Description, summary.ExcerptLength)
+	}
+
+	// The cover of the first part is the share image of the series.
+	for _, blog := range series.Blogs {
+		if blog.Cover != nil {
+			app.setShareImage(r, &data.Meta, blog.Cover, blog.CoverAlt)
+			break
+		}
+	}
+
+	app.render(w, r, http.StatusOK, "series.html", data)
+}
+
+func (app *application) seriesEdit(w http.ResponseWriter, r *http.Request) {
+	series := app.seriesFromPath(w, r)
+	if series == nil {
+		return
+	}
+
+	form := seriesEditForm{
+		Title:       series.Title,
+		Description: series.Description,
+	}
+
+	app.showSeriesEdit(w, r, http.StatusOK, series, form)
+}
+
+// showSeriesEdit() renders the edit page of a series. The blogs are listed from
+// the series, in their current order.
+func (app *application) showSeriesEdit(w http.ResponseWriter, r *http.Request, status int, series *model.Series, form seriesEditForm) {
+	data := app.newTemplateData(r)
+	data.Series = series
+	data.Form = form
+
+	app.render(w, r, status, "series_edit.html", data)
+}
+
+func (app *application) seriesEditPost(w http.ResponseWriter, r *http.Request) {
+	series := app.seriesFromPath(w, r)
+	if series == nil {
+		return
+	}
+
+	var form seriesEditForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || len(form.Blogs) != len(form.Positions) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.T = app.localizer(r).T
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "validation.blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "validation.max_chars", 100)
+
+	if form.Add != 0 {
+		_, err := app.blogs.Get(form.Add)
+		if errors.Is(err, model.ErrNoRecord) {
+			form.AddFieldError("add", "validation.blog")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.showSeriesEdit(w, r, http.StatusUnprocessableEntity, series, form)
+		return
+	}
+
+	// Sort the blogs by the positions they were given. Blogs with the same
+	// position stay in the order they were in, and only blogs which really
+	// are in the series are kept, the form could say anything. The page
+	// only lists the live blogs, Reorder() leaves the expired ones and the
+	// drafts where they are.
+	type part struct{ blogID, position int }
+
+	var parts []part
+	var remove []int
+	for i, id := range form.Blogs {
+		if !slices.ContainsFunc(series.Blogs, func(b *model.Blog) bool { return b.ID == id }) {
+			continue
+		}
+		if slices.Contains(form.Remove, id) {
+			remove = append(remove, id)
+		} else {
+			parts = append(parts, part{id, form.Positions[i]})
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].position < parts[j].position })
+
+	ids := make([]int, len(parts))
+	for i, p := range parts {
+		ids[i] = p.blogID
+	}
+
+	// The title, the order and the new blog are saved in one transaction,
+	// so the series is never half saved.
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	// Rollback() does nothing once Commit() succeeded.
+	defer tx.Rollback()
+
+	err = app.series.UpdateTx(tx, series.ID, strings.TrimSpace(form.Title), strings.TrimSpace(form.Description))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.series.ReorderTx(tx, series.ID, ids, remove)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// AddTx() moves the blog out of the series it was in, if any.
+	if form.Add != 0 && !slices.Contains(ids, form.Add) {
+		err = app.series.AddTx(tx, series.ID, form.Add, 0)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T("flash.series_saved"))
+
+	http.Redirect(w, r, seriesPath(series), http.StatusSeeOther)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/munnaMia/Story-Book/internal/model"
+)
+
+/*
+	Sitemap
+	=======
+		A sitemap (https://www.sitemaps.org/protocol.html) lists every page of
+		the site so search engines can find blogs that are no longer linked
+		from the home page: the home page, the index pages of the series,
+		and every blog with its translations. Like the <link> tags of
+		base.html, a blog and its translations point at each other with
+		xhtml:link hreflang links, so search engines know they're the same
+		post in other languages.
+
+		Note:
+			One sitemap file can hold at most 50,000 URLs. Past that we serve
+			a sitemap index at /sitemap.xml which points at /sitemaps/pages.xml,
+			with the home page and the series, and at numbered sitemaps of
+			blogs (/sitemaps/1.xml, /sitemaps/2.xml ...). A blog has one URL
+			at most for every language, so a sitemap of blogs holds 50,000
+			divided by the number of languages of them.
+*/
+
+// sitemapMaxURLs is the most URLs the protocol allows in a single sitemap.
+const sitemapMaxURLs = 50000
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	XHTMLNS string       `xml:"xmlns:xhtml,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string             `xml:"loc"`
+	LastMod    string             `xml:"lastmod,omitempty"`
+	Alternates []sitemapAlternate `xml:"xhtml:link"`
+}
+
+// sitemapAlternate is a language version of the page of a sitemapURL.
+type sitemapAlternate struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name         `xml:"sitemapindex"`
+	XMLNS    string           `xml:"xmlns,attr"`
+	Sitemaps []sitemapPointer `xml:"sitemap"`
+}
+
+type sitemapPointer struct {
+	Loc string `xml:"loc"`
+}
+
+const (
+	sitemapXMLNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	xhtmlXMLNS   = "http://www.w3.org/1999/xhtml"
+)
+
+// sitemapURLsPerBlog() returns the most URLs a blog can have in a sitemap, one
+// for every language: the blog itself and its translations.
+func (app *application) sitemapURLsPerBlog() int {
+	return max(1, len(app.i18n.Languages()))
+}
+
+func (app *application) sitemap(w http.ResponseWriter, r *http.Request) {
+	count, err := app.blogs.Count()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	series, err := app.series.Listed()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	perBlog := app.sitemapURLsPerBlog()
+
+	// Small sites get the URLs straight away.
+	if 1+len(series)+count*perBlog <= sitemapMaxURLs {
+		blogs, err := app.sitemapBlogs(r, count, 0)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		set := sitemapURLSet{XMLNS: sitemapXMLNS, XHTMLNS: xhtmlXMLNS}
+		set.URLs = append(app.sitemapPages(r, series), blogs...)
+
+		app.writeXML(w, r, set)
+		return
+	}
+
+	index := sitemapIndex{XMLNS: sitemapXMLNS}
+	index.Sitemaps = append(index.Sitemaps, sitemapPointer{Loc: app.absoluteURL(r, "/sitemaps/pages.xml")})
+
+	perFile := sitemapMaxURLs / perBlog
+	for i := 1; i <= (count+perFile-1)/perFile; i++ {
+		index.Sitemaps = append(index.Sitemaps, sitemapPointer{
+			Loc: app.absoluteURL(r, fmt.Sprintf("/sitemaps/%d.xml", i)),
+		})
+	}
+
+	app.writeXML(w, r, index)
+}
+
+func (app *application) sitemapPage(w http.ResponseWriter, r *http.Request) {
+	file := httprouter.ParamsFromContext(r.Context()).ByName("file")
+	set := sitemapURLSet{XMLNS: sitemapXMLNS, XHTMLNS: xhtmlXMLNS}
+
+	// A site doesn't have anywhere near 50,000 series, so they all fit in
+	// one sitemap with the home page.
+	if file == "pages.xml" {
+		series, err := app.series.Listed()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		set.URLs = app.sitemapPages(r, series)
+		app.writeXML(w, r, set)
+		return
+	}
+
+	// The other file names look like "2.xml", the number is the sitemap
+	// page.
+	page, err := strconv.Atoi(strings.TrimSuffix(file, ".xml"))
+	if err != nil || page < 1 || !strings.HasSuffix(file, ".xml") {
+		app.notFound(w, r)
+		return
+	}
+
+	perFile := sitemapMaxURLs / app.sitemapURLsPerBlog()
+
+	set.URLs, err = app.sitemapBlogs(r, perFile, (page-1)*perFile)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if len(set.URLs) == 0 {
+		app.notFound(w, r)
+		return
+	}
+
+	app.writeXML(w, r, set)
+}
+
+// sitemapPages() returns the URLs of the home page and of the series. We don't
+// keep when a series last changed, so they don't have a lastmod.
+func (app *application) sitemapPages(r *http.Request, series []*model.Series) []sitemapURL {
+	urls := []sitemapURL{{Loc: app.absoluteURL(r, "/")}}
+
+	for _, s := range series {
+		urls = append(urls, sitemapURL{Loc: app.absoluteURL(r, seriesPath(s))})
+	}
+	return urls
+}
+
+// sitemapBlogs() returns the URLs of a page of blogs and their translations.
+// The versions of a blog all get the same hreflang links, to every version and
+// to the blog itself as the x-default.
+func (app *application) sitemapBlogs(r *http.Request, limit, offset int) ([]sitemapURL, error) {
+	blogs, err := app.blogs.Timestamps(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(blogs))
+	for i, blog := range blogs {
+		ids[i] = blog.ID
+	}
+
+	translations, err := app.translations.ForBlogs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []sitemapURL{}
+
+	for _, blog := range blogs {
+		var links []sitemapAlternate
+		if len(translations[blog.ID]) > 0 {
+			for _, a := range app.blogAlternates(r, blog, translations[blog.ID], "") {
+				links = append(links, sitemapAlternate{Rel: "alternate", Hreflang: a.Lang, Href: a.URL})
+			}
+			links = append(links, sitemapAlternate{Rel: "alternate", Hreflang: "x-default", Href: links[0].Href})
+		}
+
+		urls = append(urls, sitemapURL{
+			Loc:        app.absoluteURL(r, fmt.Sprintf("/blog/view/%d", blog.ID)),
+			LastMod:    blog.Created.UTC().Format(time.RFC3339),
+			Alternates: links,
+		})
+
+		for _, t := range translations[blog.ID] {
+			urls = append(urls, sitemapURL{
+				Loc:        app.absoluteURL(r, translationPath(t)),
+				LastMod:    t.Created.UTC().Format(time.RFC3339),
+				Alternates: links,
+			})
+		}
+	}
+
+	return urls, nil
+}
+
+// writeXML() encodes v as an XML document with the standard header.
+func (app *application) writeXML(w http.ResponseWriter, r *http.Request, v any) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
+
+// robots writes the robots.txt file. The disallowed paths come from the
+// -robots-disallow flag and the last line points crawlers at the sitemap.
+func (app *application) robots(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+
+	b.WriteString("User-agent: *\n")
+	for _, path := range strings.Split(app.config.robotsDisallow, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			fmt.Fprintf(&b, "Disallow: %s\n", path)
+		}
+	}
+	fmt.Fprintf(&b, "\nSitemap: %s\n", app.absoluteURL(r, "/sitemap.xml"))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/munnaMia/Story-Book/internal/spam"
+)
+
+/*
+	Spam
+	====
+		Comments, new blogs and translations can be sent by anybody, so they
+		go through the spam filter (internal/spam) before they're saved. The
+		forms carry two extra hidden fields for it, see partials/antispam.html:
+
+			website    the honeypot, which only bots fill in
+			stamp      the signed time the form was shown
+
+		The blog pages are cached (by browsers, CDNs and the ETag of
+		render()), so the comment forms on them can't carry a stamp of
+		their own: it would change the page every second, and everybody
+		would get the same old stamp from the cache. Their stamp field is
+		empty, and main.js fetches a stamp from /form-stamp when the
+		visitor starts filling in the form. The create and translate pages
+		are never cached, so they still get their stamp with the page.
+		Without JavaScript a comment has no stamp, which only adds the
+		weight of MinTime to its score.
+
+		Comments use all three verdicts: approved comments are published
+		straight away, queued ones wait for a moderator and rejected ones
+		are saved as spam, so the moderation queue never sees them. Blogs
+		and translations don't have a queue, so only a Reject stops them.
+*/
+
+// antispam holds the hidden spam fields. It's embedded in the form structs,
+// and the form decoder fills in its fields like the form's own.
+type antispam struct {
+	Website string `form:"website"`
+	Stamp   string `form:"stamp"`
+}
+
+// newSpamFilter() builds the spam filter from the -spam-* flags. The corpus
+// is where the Bayesian classifier keeps what it learned.
+func newSpamFilter(cfg config, key []byte, corpus spam.Corpus) (*spam.Filter, error) {
+	var terms []string
+
+	if cfg.spamBlocklist != "" {
+		f, err := os.Open(cfg.spamBlocklist)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		terms, err = spam.ParseBlocklist(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &spam.Filter{
+		Checks: []spam.Check{
+			spam.Honeypot{Weight: 10},
+			spam.MinTime{Key: key, Min: 3 * time.Second, Max: 24 * time.Hour, Weight: 3},
+			spam.Links{Free: 1, Weight: 1.5},
+			spam.Blocklist{Terms: terms, Weight: 3},
+			&spam.Bayes{Corpus: corpus, Weight: 4, MinDocs: 10},
+		},
+		Approve: cfg.spamApprove,
+		Reject:  cfg.spamReject,
+	}, nil
+}
+
+// spamKey() returns the key form stamps are signed with. Without a
+// -spam-secret a random key is made, and the forms which were shown before
+// a restart lose their stamp.
+func spamKey(secret string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// formStamp() returns a new form stamp for the stamp field of a form.
+func (app *application) formStamp() string {
+	return spam.NewStamp(app.spamKey, time.Now())
+}
+
+// formStampGet is the handler of /form-stamp, which hands main.js a new form
+// stamp for the forms of cached pages.
+func (app *application) formStampGet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(app.formStamp()))
+}
+
+// checkSpam() runs the spam filter on the text of a form. If a check fails
+// (say the database is down) the error is logged and the verdict is at
+// least Queue, so a broken check never lets spam straight through.
+func (app *application) checkSpam(r *http.Request, fields antispam, text ...string) spam.Result {
+	submission := spam.Submission{
+		Text:     strings.Join(text, "\n"),
+		Honeypot: fields.Website,
+		Stamp:    fields.Stamp,
+	}
+
+	result, err := app.spam.Check(submission)
+	if err != nil {
+		app.errorLog.Print(err)
+		if result.Verdict == spam.Approve {
+			result.Verdict = spam.Queue
+		}
+	}
+
+	if len(result.Reasons) > 0 {
+		app.infoLog.Printf("spam %s %s: %s (score %.1f): %s", r.Method, r.URL.Path, result.Verdict, result.Score, strings.Join(result.Reasons, "; "))
+	}
+
+	return result
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"html/template"
+	"io/fs"
 	"path/filepath"
+	"slices"
 	"time"
 
+	"github.com/munnaMia/Story-Book/internal/i18n"
 	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/outline"
 )
 
 /*
@@ -18,34 +22,195 @@ type templateData struct {
 	CurrentYear int
 	Blog        *model.Blog
 	Blogs       []*model.Blog
+	Comments    []*model.Comment
+	Reactions   map[int][]reaction
+	Media       []*model.Media
+	Outline     *outline.Outline
+	Stats       *siteStats
+	System      *systemInfo
+	Staff       []staffMember
+	Related     []*model.Blog
+	Series      *model.Series
+	SeriesList  []*model.Series
+	SeriesPart  int
+	PrevBlog    *model.Blog
+	NextBlog    *model.Blog
+	Page        int
+	PrevPage    int
+	NextPage    int
 	Form        any
+	FormStamp   string
+	CSRFToken   string // only on the moderators' pages, see middleware.go
 	Flash       string
+	Loc         i18n.Localizer
+	Languages   []language
+	Timezones   []string
+	Meta        pageMeta
+	Status      int
+	StatusText  string
+	Message     string
+}
+
+// commonTimezones are the suggestions for the timezone field of the preferences
+// page. Any other IANA timezone name can be typed in as well.
+var commonTimezones = []string{
+	"UTC",
+	"Asia/Dhaka",
+	"Asia/Kolkata",
+	"Asia/Dubai",
+	"Asia/Singapore",
+	"Asia/Tokyo",
+	"Australia/Sydney",
+	"Europe/London",
+	"Europe/Berlin",
+	"Europe/Istanbul",
+	"Africa/Cairo",
+	"America/New_York",
+	"America/Chicago",
+	"America/Denver",
+	"America/Los_Angeles",
+	"America/Sao_Paulo",
+}
+
+// language is an entry of the language switcher in the nav.
+type language struct {
+	Code string
+	Name string
+}
+
+/*
+	pageMeta
+	========
+		holds the data for the <head> of base.html which tells search engines
+		and chat tools (Slack, Discord, Twitter...) how to show a link to the page.
+
+		Title is the share title. When it's empty base.html uses the site name.
+		Image is the absolute URL of the picture shown with the link, with
+		its size and alt text, or "" when the page doesn't have one.
+		JSONLD is any value which html/template encodes as JSON inside the
+		<script type="application/ld+json"> block. It's a data block and is
+		never executed, so it doesn't break our Content-Security-Policy.
+*/
+
+type pageMeta struct {
+	Title        string
+	CanonicalURL string
+	Description  string
+	Type         string
+	Alternates   []alternate
+	Image        string
+	ImageWidth   int
+	ImageHeight  int
+	ImageAlt     string
+	JSONLD       any
+}
+
+// alternate is one language version of a page. They're listed as hreflang
+// links in base.html, and view.html shows them as a language switcher.
+type alternate struct {
+	Lang    string
+	Name    string
+	URL     string
+	Current bool
+}
+
+// blogPosting is the schema.org BlogPosting (https://schema.org/BlogPosting)
+// structured data for a blog page.
+type blogPosting struct {
+	Context          string       `json:"@context"`
+	Type             string       `json:"@type"`
+	Headline         string       `json:"headline"`
+	Description      string       `json:"description"`
+	URL              string       `json:"url"`
+	MainEntityOfPage string       `json:"mainEntityOfPage"`
+	InLanguage       string       `json:"inLanguage,omitempty"`
+	DatePublished    string       `json:"datePublished"`
+	DateModified     string       `json:"dateModified"`
+	Image            string       `json:"image,omitempty"`
+	Author           schemaPerson `json:"author"`
+}
+
+type schemaPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// readingTime() returns how long a blog takes to read, like "4 min read".
+func readingTime(loc i18n.Localizer, b *model.Blog) string {
+	return loc.Count("blog.minute_read", "blog.minutes_read", b.Minutes)
+}
+
+// wordCount() returns the number of words of a blog, like "820 words".
+func wordCount(loc i18n.Localizer, b *model.Blog) string {
+	return loc.Count("blog.word", "blog.words", b.Words)
 }
 
 // Create a humanDate function which returns a nicely formatted string
-// representation of a time.Time object.
-func humanDate(t time.Time) string {
-	return t.Format("02 Jan 2006 at 15:04")
+// representation of a time.Time object, in the language of the page.
+func humanDate(loc i18n.Localizer, t time.Time) string {
+	return loc.Date(t)
+}
+
+// timeAgo returns how long ago (or how long from now) t is, like "3 hours ago",
+// in the language of the page.
+func timeAgo(loc i18n.Localizer, t time.Time) string {
+	return loc.Relative(t, time.Now())
+}
+
+// isoDate returns t in the RFC 3339 format, for the machine readable datetime
+// attribute of <time> elements.
+func isoDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// hasID reports whether id is in ids, like the IDs of the picked images of a form.
+func hasID(ids []int, id int) bool {
+	return slices.Contains(ids, id)
+}
+
+// inc returns n + 1, for numbering from 1 in a {{range $i, $x := ...}} loop.
+func inc(n int) int {
+	return n + 1
+}
+
+// The T function returns the message for key in the language of the page. It's
+// called like {{T .Loc "nav.home"}}, or {{T $.Loc "nav.home"}} inside a
+// {{with}} or {{range}} block.
+func translate(loc i18n.Localizer, key string, args ...any) string {
+	return loc.T(key, args...)
 }
 
 // Initialize a template.FuncMap object and store it in a global variable. This is
 // essentially a string-keyed map which acts as a lookup between the names of our
 // custom template functions and the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":   humanDate,
+	"timeAgo":     timeAgo,
+	"isoDate":     isoDate,
+	"readingTime": readingTime,
+	"wordCount":   wordCount,
+	"T":           translate,
+	"mediaURL":    mediaURL,
+	"srcset":      srcset,
+	"fileSize":    fileSize,
+	"hasID":       hasID,
+	"inc":         inc,
 }
 
-func newTemplateCache() (map[string]*template.Template, error) {
+// newTemplateCache() parses every page in the html/pages folder of fsys, together
+// with the base layout and the partials, into its own template set. The assets
+// give the templates the hashed URLs of the static files.
+func newTemplateCache(fsys fs.FS, assets *staticAssets) (map[string]*template.Template, error) {
 	// Initialize a new map to act as the cache.
 	cache := map[string]*template.Template{}
 
 	/*
-		Use the filepath.Glob() function to get a slice of all filepaths that
-		match the pattern "./ui/html/pages/*.html". This will essentially gives
-		us a slice of all the filepaths for our application 'page' templates
-		like: [ui/html/pages/home.html ui/html/pages/view.html]
+		Use the fs.Glob() function to get a slice of all filepaths in the
+		file system that match the pattern "html/pages/*.html". This will
+		essentially gives us a slice of all the filepaths for our application
+		'page' templates like: [html/pages/home.html html/pages/view.html]
 	*/
-	pages, err := filepath.Glob("./ui/html/pages/*.html")
+	pages, err := fs.Glob(fsys, "html/pages/*.html")
 	if err != nil {
 		return nil, err
 	}
@@ -56,24 +221,24 @@ func newTemplateCache() (map[string]*template.Template, error) {
 		// and assign it to the name variable.
 		name := filepath.Base(page)
 
-		// Parse the base template file into a template set.
-		// The template.FuncMap must be registered with the template set before you
-		// call the ParseFiles() method. This means we have to use template.New() to
-		// create an empty template set, use the Funcs() method to register the
-		// template.FuncMap, and then parse the file as normal.
-		ts, err := template.New(name).Funcs(functions).ParseFiles("./ui/html/base.html")
-		if err != nil {
-			return nil, err
-		}
-
-		// Call ParseGlob() *on this template set* to add any partials.
-		ts, err = ts.ParseGlob("./ui/html/partials/*.html")
-		if err != nil {
-			return nil, err
+		// Create a slice containing the filepath patterns for the templates we
+		// want to parse: the base template, the partials and the page.
+		patterns := []string{
+			"html/base.html",
+			"html/partials/*.html",
+			page,
 		}
 
-		// Call ParseFiles() *on this template set* to add the page template.
-		ts, err = ts.ParseFiles(page)
+		// The template.FuncMap must be registered with the template set before you
+		// call the ParseFS() method. This means we have to use template.New() to
+		// create an empty template set, use the Funcs() method to register the
+		// template.FuncMap, and then parse the files as normal. ParseFS() works
+		// like ParseFiles() and ParseGlob() but reads from the given fs.FS.
+		// The static function is registered on its own because it needs the
+		// hashed file names, which we only know once the application starts.
+		ts, err := template.New(name).Funcs(functions).Funcs(template.FuncMap{
+			"static": assets.URL,
+		}).ParseFS(fsys, patterns...)
 		if err != nil {
 			return nil, err
 		}
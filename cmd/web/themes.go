@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+	Themes
+	======
+		A theme is a folder with the same layout as ui/:
+
+			themes/dark/html/base.html
+			themes/dark/html/partials/nav.html
+			themes/dark/html/pages/home.html
+			themes/dark/static/css/main.css
+
+		A theme only needs the files it changes. Anything missing is taken
+		from the default ui (the embedded one, or -ui-dir).
+
+		Every theme gets its own template cache and its own hashed static
+		files. Which theme a request uses is chosen by its host, so each of
+		the blogs we host can have its own look:
+
+			-themes-dir="./themes" -theme="default" -site-themes="dark.example.com=dark"
+
+		Note:
+			The theme called "default" is the plain ui without any overlay.
+*/
+
+// defaultTheme is the name of the theme which is just the default ui.
+const defaultTheme = "default"
+
+// theme holds everything the application needs to render with one theme.
+type theme struct {
+	name          string
+	ui            fs.FS
+	static        fs.FS
+	assets        *staticAssets
+	templateCache map[string]*template.Template
+	fileserver    http.Handler
+}
+
+// newTheme() builds a theme from a ui file system. In development mode the
+// static files aren't hashed, because they change all the time. The hashed
+// files are linked under staticURL when it isn't "".
+func newTheme(name string, ui fs.FS, dev bool, staticURL string) (*theme, error) {
+	// fs.Sub() gives us the static folder as a file system of its own, so the
+	// file server can't reach the templates in the html folder.
+	static, err := fs.Sub(ui, "static")
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the static files so the templates can link them with far-future
+	// caching. In development mode we leave the hashes out and the plain
+	// names are used.
+	assets := &staticAssets{}
+	if !dev {
+		assets, err = newStaticAssets(static)
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: %w", name, err)
+		}
+		assets.base = strings.TrimSuffix(staticURL, "/")
+	}
+
+	templateCache, err := newTemplateCache(ui, assets)
+	if err != nil {
+		return nil, fmt.Errorf("theme %s: %w", name, err)
+	}
+
+	return &theme{
+		name:          name,
+		ui:            ui,
+		static:        static,
+		assets:        assets,
+		templateCache: templateCache,
+		// The immutable middleware serves the hashed names of the files (see
+		// assets.go) with far-future caching. serveStatic() wraps
+		// http.FileServer so pre-compressed .br/.gz copies of a file are used
+		// when they exist.
+		fileserver: assets.immutable(serveStatic(http.FS(static))),
+	}, nil
+}
+
+// loadThemes() builds the default theme from base, plus every theme named in
+// -theme and -site-themes from the folders in -themes-dir.
+func loadThemes(cfg config, base fs.FS, siteThemes map[string]string) (map[string]*theme, error) {
+	names := map[string]bool{defaultTheme: true, cfg.theme: true}
+	for _, name := range siteThemes {
+		names[name] = true
+	}
+
+	themes := map[string]*theme{}
+
+	for name := range names {
+		ui := base
+
+		if name != defaultTheme {
+			dir := filepath.Join(cfg.themesDir, name)
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("theme %s: folder %s not found", name, dir)
+			}
+
+			ui = overlayFS{top: os.DirFS(dir), bottom: base}
+		}
+
+		t, err := newTheme(name, ui, cfg.dev, cfg.staticURL)
+		if err != nil {
+			return nil, err
+		}
+
+		themes[name] = t
+	}
+
+	return themes, nil
+}
+
+// parseSiteThemes() parses the -site-themes flag, a comma separated list of
+// host=theme pairs, into a map of host to theme name.
+func parseSiteThemes(value string) (map[string]string, error) {
+	siteThemes := map[string]string{}
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		host, name, ok := strings.Cut(pair, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		name = strings.TrimSpace(name)
+		if !ok || host == "" || name == "" {
+			return nil, fmt.Errorf("invalid -site-themes entry %q, want host=theme", pair)
+		}
+
+		siteThemes[host] = name
+	}
+
+	return siteThemes, nil
+}
+
+// themeFor() returns the theme for the host of the request, or the configured
+// -theme when the host doesn't have one of its own.
+func (app *application) themeFor(r *http.Request) *theme {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if name, ok := app.siteThemes[strings.ToLower(host)]; ok {
+		return app.themes[name]
+	}
+	return app.themes[app.config.theme]
+}
+
+// staticFile is the handler for /static/, it passes the request on to the
+// file server of the request's theme.
+func (app *application) staticFile(w http.ResponseWriter, r *http.Request) {
+	app.themeFor(r).fileserver.ServeHTTP(w, r)
+}
+
+/*
+	overlayFS
+	=========
+		is a fs.FS which looks for a file in top first and then in bottom.
+		Reading a directory gives the entries of both, with the ones in top
+		winning, so fs.Glob() in newTemplateCache() finds the pages of the
+		theme and the pages of the default ui together.
+*/
+
+type overlayFS struct {
+	top    fs.FS
+	bottom fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return o.bottom.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	top, topErr := fs.ReadDir(o.top, name)
+	bottom, bottomErr := fs.ReadDir(o.bottom, name)
+
+	if topErr != nil && bottomErr != nil {
+		return nil, bottomErr
+	}
+
+	merged := map[string]fs.DirEntry{}
+	for _, entry := range bottom {
+		merged[entry.Name()] = entry
+	}
+	for _, entry := range top {
+		merged[entry.Name()] = entry
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/munnaMia/Story-Book/internal/model"
+	"github.com/munnaMia/Story-Book/internal/spam"
+	"github.com/munnaMia/Story-Book/internal/validator"
+)
+
+/*
+	Translations
+	============
+		A blog can be translated into the other languages we have message
+		catalogs for. The blog itself stays the canonical post at
+		/blog/view/:id, and every translation gets a URL which starts with
+		its language code and ends with its own slug:
+
+			/blog/view/7           the canonical post (in English)
+			/bn/blog/amar-golpo    its Bengali translation
+
+		Every version links to all the others with hreflang links in
+		base.html, so search engines show readers the one in their language.
+*/
+
+// translationForm is the form of the translate page.
+type translationForm struct {
+	Lang                string `form:"lang"`
+	Slug                string `form:"slug"`
+	Title               string `form:"title"`
+	Content             string `form:"content"`
+	validator.Validator `form:"-"`
+	antispam
+}
+
+// translationPath() returns the path of a translation, like "/bn/blog/amar-golpo".
+func translationPath(t *model.Translation) string {
+	return fmt.Sprintf("/%s/blog/%s", t.Lang, url.PathEscape(t.Slug))
+}
+
+// blogAlternates() returns every language version of a blog, with the one in
+// the lang language marked as the current one.
+func (app *application) blogAlternates(r *http.Request, blog *model.Blog, translations []*model.Translation, lang string) []alternate {
+	alternates := []alternate{{
+		Lang:    blog.Lang,
+		Name:    app.i18n.Translate(blog.Lang, "language.name"),
+		URL:     app.absoluteURL(r, fmt.Sprintf("/blog/view/%d", blog.ID)),
+		Current: blog.Lang == lang,
+	}}
+
+	for _, t := range translations {
+		alternates = append(alternates, alternate{
+			Lang:    t.Lang,
+			Name:    app.i18n.Translate(t.Lang, "language.name"),
+			URL:     app.absoluteURL(r, translationPath(t)),
+			Current: t.Lang == lang,
+		})
+	}
+
+	return alternates
+}
+
+// blogTranslationView() returns the handler for the translations in lang. It
+// is registered once for every language, on /<lang>/blog/:slug.
+func (app *application) blogTranslationView(lang string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		param := httprouter.ParamsFromContext(r.Context())
+
+		translation, err := app.translations.GetBySlug(lang, param.ByName("slug"))
+		if err != nil {
+			if errors.Is(err, model.ErrNoRecord) {
+				app.notFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		blog, err := app.blogs.Get(translation.BlogID)
+		if err != nil {
+			if errors.Is(err, model.ErrNoRecord) {
+				app.notFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		app.showBlog(w, r, http.StatusOK, blog, translation, commentForm{})
+	}
+}
+
+// blogFromParam() reads the :id parameter of the URL and returns that blog.
+// When it fails it has already sent the error response and returns nil.
+func (app *application) blogFromParam(w http.ResponseWriter, r *http.Request) *model.Blog {
+	param := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(param.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return nil
+	}
+
+	blog, err := app.blogs.Get(id)
+	if err != nil {
+		if errors.Is(err, model.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+
+	return blog
+}
+
+func (app *application) blogTranslate(w http.ResponseWriter, r *http.Request) {
+	blog := app.blogFromParam(w, r)
+	if blog == nil {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Blog = blog
+	data.Form = translationForm{}
+	data.FormStamp = app.formStamp()
+
+	app.render(w, r, http.StatusOK, "translate.html", data)
+}
+
+func (app *application) blogTranslatePost(w http.ResponseWriter, r *http.Request) {
+	blog := app.blogFromParam(w, r)
+	if blog == nil {
+		return
+	}
+
+	var form translationForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.T = app.localizer(r).T
+	form.Slug = strings.ToLower(strings.TrimSpace(form.Slug))
+
+	form.CheckField(app.i18n.Has(form.Lang), "lang", "validation.lang")
+	form.CheckField(form.Lang != blog.Lang, "lang", "validation.same_lang")
+	form.CheckField(validator.NotBlank(form.Slug), "slug", "validation.blank")
+	form.CheckField(validator.MaxChars(form.Slug, 120), "slug", "validation.max_chars", 120)
+	form.CheckField(validator.Matches(form.Slug, validator.SlugRX), "slug", "validation.slug")
+	form.CheckField(validator.NotBlank(form.Title), "title", "validation.blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "validation.max_chars", 100)
+	form.CheckField(validator.NotBlank(form.Content), "content", "validation.blank")
+
+	if form.Valid() && app.checkSpam(r, form.antispam, form.Title, form.Content).Verdict == spam.Reject {
+		form.AddFieldError("content", "validation.spam")
+	}
+
+	if form.Valid() {
+		_, err = app.translations.Insert(blog.ID, form.Lang, form.Slug, form.Title, form.Content)
+		switch {
+		case errors.Is(err, model.ErrDuplicateSlug):
+			form.AddFieldError("slug", "validation.slug_taken")
+		case errors.Is(err, model.ErrDuplicateTranslation):
+			form.AddFieldError("lang", "validation.translation_exists")
+		case err != nil:
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Blog = blog
+		data.Form = form
+		data.FormStamp = app.formStamp()
+		app.render(w, r, http.StatusUnprocessableEntity, "translate.html", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.localizer(r).T("flash.translation_created"))
+
+	http.Redirect(w, r, translationPath(&model.Translation{Lang: form.Lang, Slug: form.Slug}), http.StatusSeeOther)
+}
@@ -2,13 +2,15 @@ module github.com/munnaMia/Story-Book
 
 go 1.24.0
 
-require github.com/go-sql-driver/mysql v1.9.3
-
 require (
-	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/alexedwards/scs/mysqlstore v0.0.0-20250417082927-ab20b3feb5e9 // indirect
-	github.com/alexedwards/scs/v2 v2.9.0 // indirect
-	github.com/go-playground/form/v4 v4.2.1 // indirect
-	github.com/julienschmidt/httprouter v1.3.0 // indirect
-	github.com/justinas/alice v1.2.0 // indirect
+	github.com/alexedwards/scs/mysqlstore v0.0.0-20250417082927-ab20b3feb5e9
+	github.com/alexedwards/scs/v2 v2.9.0
+	github.com/andybalholm/brotli v1.2.6
+	github.com/go-playground/form/v4 v4.2.1
+	github.com/go-sql-driver/mysql v1.9.3
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/justinas/alice v1.2.0
+	golang.org/x/image v0.30.0
 )
+
+require filippo.io/edwards25519 v1.1.0 // indirect
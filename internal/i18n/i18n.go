@@ -0,0 +1,307 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Message catalogs
+	================
+		Every language has a JSON file in ui/locales named after its language
+		code (en.json, bn.json...) which maps a message key to the text:
+
+			{
+				"nav.home": "Home",
+				"validation.max_chars": "This field cannot be more than %d characters long"
+			}
+
+		The text is a fmt format string, so messages can take arguments.
+
+		Note:
+			A key missing from a catalog falls back to the default language,
+			and a key missing from that is shown as it is. A missing
+			translation never breaks a page.
+*/
+
+// Bundle holds the message catalogs of every language.
+type Bundle struct {
+	catalogs map[string]map[string]string
+	fallback string
+}
+
+// Load() reads every *.json catalog in the dir folder of fsys. The fallback is
+// the default language, it must have a catalog.
+func Load(fsys fs.FS, dir, fallback string) (*Bundle, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		catalogs: map[string]map[string]string{},
+		fallback: fallback,
+	}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		catalog := map[string]string{}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", file, err)
+		}
+
+		lang := strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))
+		b.catalogs[lang] = catalog
+	}
+
+	if _, ok := b.catalogs[fallback]; !ok {
+		return nil, fmt.Errorf("i18n: no catalog for the default language %q", fallback)
+	}
+
+	return b, nil
+}
+
+// Languages() returns the codes of every language with a catalog, sorted.
+func (b *Bundle) Languages() []string {
+	langs := make([]string, 0, len(b.catalogs))
+	for lang := range b.catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Has() reports whether there is a catalog for lang.
+func (b *Bundle) Has(lang string) bool {
+	_, ok := b.catalogs[lang]
+	return ok
+}
+
+// Fallback() returns the default language.
+func (b *Bundle) Fallback() string {
+	return b.fallback
+}
+
+// Translate() returns the message for key in lang, formatted with args.
+func (b *Bundle) Translate(lang, key string, args ...any) string {
+	msg, ok := b.catalogs[lang][key]
+	if !ok {
+		msg, ok = b.catalogs[b.fallback][key]
+	}
+	if !ok {
+		msg = key
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Match() returns the first of the preferred languages that has a catalog. A
+// regional code like "bn-BD" also matches the "bn" catalog. When nothing
+// matches it returns the default language.
+func (b *Bundle) Match(preferred ...string) string {
+	for _, lang := range preferred {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" {
+			continue
+		}
+
+		if b.Has(lang) {
+			return lang
+		}
+
+		if base, _, ok := strings.Cut(lang, "-"); ok && b.Has(base) {
+			return base
+		}
+	}
+
+	return b.fallback
+}
+
+// ParseAcceptLanguage() returns the languages of an Accept-Language header,
+// most preferred first. Languages with q=0 are left out.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var langs []weighted
+
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.TrimSpace(lang)
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+
+		if q > 0 {
+			langs = append(langs, weighted{lang, q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	result := make([]string, len(langs))
+	for i, l := range langs {
+		result[i] = l.lang
+	}
+	return result
+}
+
+// Localizer translates messages and formats dates for one language and
+// timezone. It's a small value which is made once per request.
+type Localizer struct {
+	Lang string
+	// Location is the timezone dates are shown in. When it's nil dates are
+	// shown in UTC, which is how they are stored.
+	Location *time.Location
+	bundle   *Bundle
+}
+
+// Localizer() returns the Localizer for lang.
+func (b *Bundle) Localizer(lang string) Localizer {
+	return Localizer{Lang: lang, bundle: b}
+}
+
+// T() returns the message for key, formatted with args.
+func (l Localizer) T(key string, args ...any) string {
+	if l.bundle == nil {
+		return key
+	}
+	return l.bundle.Translate(l.Lang, key, args...)
+}
+
+// Count() returns the message of singular when n is 1 and of plural otherwise,
+// formatted with n in the digits of the language, like "5 words" or "৫টি শব্দ".
+func (l Localizer) Count(singular, plural string, n int) string {
+	key := plural
+	if n == 1 {
+		key = singular
+	}
+	return l.digits(l.T(key, n))
+}
+
+/*
+	Date formatting
+	===============
+		Date() formats a time with the Go layout in the "date.layout" message
+		of the language. Go only knows English month names, so the names are
+		swapped for the ones in the "date.months" and "date.months_short"
+		messages (comma separated, January first), and the digits for the
+		ten characters in "date.digits" when the language has its own.
+*/
+
+// Date() formats t for the language and timezone of the Localizer.
+func (l Localizer) Date(t time.Time) string {
+	layout := l.T("date.layout")
+	if layout == "date.layout" {
+		layout = "02 Jan 2006 at 15:04"
+	}
+
+	t = t.In(l.location())
+	out := t.Format(layout)
+
+	month := int(t.Month()) - 1
+
+	if names := strings.Split(l.T("date.months"), ","); len(names) == 12 && strings.Contains(layout, "January") {
+		out = strings.ReplaceAll(out, t.Month().String(), strings.TrimSpace(names[month]))
+	} else if names := strings.Split(l.T("date.months_short"), ","); len(names) == 12 && strings.Contains(layout, "Jan") {
+		out = strings.ReplaceAll(out, t.Format("Jan"), strings.TrimSpace(names[month]))
+	}
+
+	return l.digits(out)
+}
+
+// digits() swaps the digits in s for the ones of the language, if it has its own.
+func (l Localizer) digits(s string) string {
+	digits := []rune(l.T("date.digits"))
+	if len(digits) != 10 {
+		return s
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return digits[r-'0']
+		}
+		return r
+	}, s)
+}
+
+func (l Localizer) location() *time.Location {
+	if l.Location == nil {
+		return time.UTC
+	}
+	return l.Location
+}
+
+/*
+	Relative dates
+	==============
+		Relative() describes t from the point of view of now, like "3 hours
+		ago" or "in 6 days". The messages come in a singular and a plural
+		form ("time.hour_ago" and "time.hours_ago"), because most languages
+		say one hour differently from many hours.
+*/
+
+// relativeUnits are the steps of Relative(), from the biggest to the smallest.
+var relativeUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+}
+
+// Relative() describes t relative to now in the language of the Localizer.
+func (l Localizer) Relative(t, now time.Time) string {
+	d := now.Sub(t)
+
+	direction := "ago"
+	if d < 0 {
+		direction = "in"
+		d = -d
+	}
+
+	for _, unit := range relativeUnits {
+		n := int(d / unit.size)
+		if n < 1 {
+			continue
+		}
+
+		key := fmt.Sprintf("time.%s_%s", unit.name, direction)
+		if n > 1 {
+			key = fmt.Sprintf("time.%ss_%s", unit.name, direction)
+		}
+
+		return l.digits(l.T(key, n))
+	}
+
+	return l.T("time.now")
+}
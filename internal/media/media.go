@@ -0,0 +1,213 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder with image.Decode()
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder with image.Decode()
+)
+
+/*
+	Image processing
+	================
+		Process() turns an uploaded image into the files we serve:
+
+			<hash>/full.jpg     the whole image, re-encoded
+			<hash>/w320.jpg     resized to 320 pixels wide
+			<hash>/w640.jpg     ...and to every other width in Widths
+			                    which is smaller than the image
+
+		Re-encoding drops everything but the pixels, so the served files
+		never carry the EXIF data of the camera (which can have the GPS
+		position of where the photo was taken). The upload itself is kept as
+		it is under originals/, which is never served.
+
+		The type of an upload is sniffed from its first bytes, never taken
+		from the file name or the Content-Type the browser sent. JPEG and
+		WebP images become JPEG files, PNG and GIF images become PNG files
+		(an animated GIF keeps only its first frame).
+*/
+
+// Widths are the widths of the resized copies of an image.
+var Widths = []int{320, 640, 1280}
+
+// MaxPixels is the largest image (width × height) we decode. A small file can
+// claim to be a huge image, which would take all the memory to decode.
+const MaxPixels = 40_000_000
+
+var (
+	// ErrUnsupported is returned for files which aren't a JPEG, PNG, GIF or
+	// WebP image.
+	ErrUnsupported = errors.New("media: unsupported image type")
+	// ErrTooLarge is returned for images with more than MaxPixels pixels.
+	ErrTooLarge = errors.New("media: image too large")
+)
+
+// File is one of the files made from an upload.
+type File struct {
+	Key         string
+	ContentType string
+	Data        []byte
+}
+
+// Image is a processed upload.
+type Image struct {
+	// Hash is the SHA-256 of the upload, the same image always gets the
+	// same hash.
+	Hash        string
+	ContentType string
+	Width       int
+	Height      int
+	// Files are the original and the files to serve.
+	Files []File
+}
+
+// types maps the sniffed type of an upload to the type of the served files.
+var types = map[string]string{
+	"image/jpeg": "image/jpeg",
+	"image/webp": "image/jpeg",
+	"image/png":  "image/png",
+	"image/gif":  "image/png",
+}
+
+// extensions are the file extensions of the types.
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/webp": "webp",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Sniff() returns the type of an upload from its first bytes, and whether it's
+// an image type we accept.
+func Sniff(data []byte) (string, bool) {
+	contentType := http.DetectContentType(data)
+	_, ok := types[contentType]
+	return contentType, ok
+}
+
+// Key() returns the key of the served file of an image which is width pixels
+// wide, or of the whole image when width is 0.
+func Key(hash, contentType string, width int) string {
+	name := "full"
+	if width > 0 {
+		name = fmt.Sprintf("w%d", width)
+	}
+	return fmt.Sprintf("%s/%s.%s", hash, name, extensions[contentType])
+}
+
+// OriginalKey() returns the key of the upload as it was sent.
+func OriginalKey(hash, uploadType string) string {
+	return fmt.Sprintf("originals/%s.%s", hash, extensions[uploadType])
+}
+
+// VariantWidths() returns the widths of the resized copies an image which is
+// width pixels wide has.
+func VariantWidths(width int) []int {
+	var widths []int
+	for _, w := range Widths {
+		if w < width {
+			widths = append(widths, w)
+		}
+	}
+	return widths
+}
+
+// Process() checks and decodes an upload, and makes the files to store.
+func Process(data []byte) (*Image, error) {
+	uploadType, ok := Sniff(data)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	// Phones store photos the way the sensor saw them and say in the EXIF
+	// data how to turn them. We're about to drop the EXIF data, so the
+	// image has to be turned first.
+	if uploadType == "image/jpeg" {
+		src = orient(src, jpegOrientation(data))
+	}
+
+	sum := sha256.Sum256(data)
+	img := &Image{
+		Hash:        hex.EncodeToString(sum[:]),
+		ContentType: types[uploadType],
+		Width:       src.Bounds().Dx(),
+		Height:      src.Bounds().Dy(),
+	}
+
+	img.Files = append(img.Files, File{
+		Key:         OriginalKey(img.Hash, uploadType),
+		ContentType: uploadType,
+		Data:        data,
+	})
+
+	full, err := encode(src, img.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	img.Files = append(img.Files, File{
+		Key:         Key(img.Hash, img.ContentType, 0),
+		ContentType: img.ContentType,
+		Data:        full,
+	})
+
+	for _, w := range VariantWidths(img.Width) {
+		h := img.Height * w / img.Width
+		if h < 1 {
+			h = 1
+		}
+
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+		resized, err := encode(dst, img.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		img.Files = append(img.Files, File{
+			Key:         Key(img.Hash, img.ContentType, w),
+			ContentType: img.ContentType,
+			Data:        resized,
+		})
+	}
+
+	return img, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
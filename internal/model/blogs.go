@@ -3,7 +3,10 @@ package model
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
+
+	"github.com/munnaMia/Story-Book/internal/summary"
 )
 
 /*
@@ -11,11 +14,81 @@ import (
 */
 
 type Blog struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID        int
+	Title     string
+	Content   string
+	Lang      string // language code of the content, like "en" or "bn"
+	Created   time.Time
+	Expires   time.Time
+	Modified  time.Time // the last change of anything its page shows, see touchBlog()
+	Published bool      // false for drafts, which only the admin dashboard shows
+	Words     int       // the word count, worked out when the blog is written (see internal/summary)
+	Minutes   int       // the reading time, also worked out when it's written
+	Excerpt   string    // the first sentences of the content, without the Markdown
+	Cover     *Media    // the cover image, nil when the blog doesn't have one
+	CoverAlt  string    // what the cover image shows, for people who can't see it
+	Tags      []string  // only filled in by the handlers which show them, see TagsFor()
+}
+
+/*
+	Cover images
+	============
+		The cover of a blog is an image of the media library, joined in with
+		a LEFT JOIN. A blog without a cover gets NULL in every column of the
+		image, so they're scanned into a blogCover of sql.Null* values first
+		and only become a Media when there is one.
+*/
+
+// blogColumns are the columns Get(), Latest() and Page() read, in the order
+// scanBlog() scans them.
+const blogColumns = `b.id, b.title, b.content, b.lang, b.created, b.expires, b.modified, b.published,
+	b.word_count, b.reading_time, b.excerpt, b.cover_alt,
+	c.id, c.hash, c.name, c.content_type, c.width, c.height, c.size, c.created`
+
+// blogFrom is the FROM clause that goes with blogColumns.
+const blogFrom = `FROM blogs b LEFT JOIN media c ON c.id = b.cover_id`
+
+// blogLive is the condition of the blogs the public pages show, the blogs b
+// which are published and haven't expired. Drafts are only on the admin
+// dashboard.
+const blogLive = `b.published AND b.expires > UTC_TIMESTAMP()`
+
+type blogCover struct {
+	ID          sql.NullInt64
+	Hash        sql.NullString
+	Name        sql.NullString
+	ContentType sql.NullString
+	Width       sql.NullInt64
+	Height      sql.NullInt64
+	Size        sql.NullInt64
+	Created     sql.NullTime
+}
+
+func scanBlog(s scanner) (*Blog, error) {
+	b := &Blog{}
+	c := blogCover{}
+
+	err := s.Scan(&b.ID, &b.Title, &b.Content, &b.Lang, &b.Created, &b.Expires, &b.Modified, &b.Published,
+		&b.Words, &b.Minutes, &b.Excerpt, &b.CoverAlt,
+		&c.ID, &c.Hash, &c.Name, &c.ContentType, &c.Width, &c.Height, &c.Size, &c.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ID.Valid {
+		b.Cover = &Media{
+			ID:          int(c.ID.Int64),
+			Hash:        c.Hash.String,
+			Name:        c.Name.String,
+			ContentType: c.ContentType.String,
+			Width:       int(c.Width.Int64),
+			Height:      int(c.Height.Int64),
+			Size:        c.Size.Int64,
+			Created:     c.Created.Time,
+		}
+	}
+
+	return b, nil
 }
 
 // Define a blogModel type which wraps a sql.DB connection pool.
@@ -30,23 +103,36 @@ type BlogModel struct {
 }
 
 // This will insert a new blog into the database.
-func (m *BlogModel) Insert(title string, content string, expires int) (int, error) {
+func (m *BlogModel) Insert(title string, content string, lang string, expires int) (int, error) {
+	return insertBlog(m.DB, title, content, lang, expires)
+}
+
+// This will insert a new blog like Insert(), in the transaction tx.
+func (m *BlogModel) InsertTx(tx *sql.Tx, title string, content string, lang string, expires int) (int, error) {
+	return insertBlog(tx, title, content, lang, expires)
+}
+
+func insertBlog(db execer, title string, content string, lang string, expires int) (int, error) {
 	/*
 		Write the SQL statement we want to execute. I've split it over two lines
 		for readability (which is why it's surrounded with backquotes instead
 		of normal double quotes).
 	*/
-	stmt := `INSERT INTO blogs (title, content, created, expires) 
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	stmt := `INSERT INTO blogs (title, content, lang, created, modified, expires, word_count, reading_time, excerpt) 
+	VALUES(?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?, ?, ?)`
+
+	// The word count, reading time and excerpt are saved with the blog, so
+	// the pages listing blogs don't work them out every time.
+	sum := summary.Of(content)
 
 	/*
-		Use the Exec() method on the embedded connection pool to execute the
+		Use the Exec() method on the connection pool (or transaction) to execute the
 		statement. The first parameter is the SQL statement, followed by the
-		title, content and expiry values for the placeholder parameters. This
+		title, content, language, expiry and summary values for the placeholder parameters. This
 		method returns a sql.Result type, which contains some basic
 		information about what happened when the statement was executed.
 	*/
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	result, err := db.Exec(stmt, title, content, lang, expires, sum.Words, sum.ReadingTime, sum.Excerpt)
 	if err != nil {
 		return 0, err
 	}
@@ -65,8 +151,8 @@ func (m *BlogModel) Insert(title string, content string, expires int) (int, erro
 // This will return a specific blog based on its id
 func (m *BlogModel) Get(id int) (*Blog, error) {
 
-	stmt := `SELECT id, title, content, created, expires FROM blogs
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT ` + blogColumns + ` ` + blogFrom + `
+	WHERE ` + blogLive + ` AND b.id = ?`
 
 	/*
 		Use the QueryRow() method on the connection pool to execute our
@@ -76,17 +162,14 @@ func (m *BlogModel) Get(id int) (*Blog, error) {
 	*/
 	row := m.DB.QueryRow(stmt, id)
 
-	// Initialize a pointer to a new zeroed Blogs struct.
-	s := &Blog{}
-
 	/*
-		Use row.Scan() to copy the values from each field in sql.Row to the
-		corresponding field in the blog struct. Notice that the arguments
-		to row.Scan are *pointers* to the place you want to copy the data into,
-		and the number of arguments must be exactly the same as the number of
-		columns returned by your statement.
+		scanBlog() uses row.Scan() to copy the values from each field in sql.Row
+		to the corresponding field in a new blog struct. Notice that the
+		arguments to row.Scan are *pointers* to the place you want to copy the
+		data into, and the number of arguments must be exactly the same as the
+		number of columns returned by your statement.
 	*/
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	s, err := scanBlog(row)
 
 	if err != nil {
 		/*
@@ -107,8 +190,8 @@ func (m *BlogModel) Get(id int) (*Blog, error) {
 
 // This will return the 10 most recently created blogs.
 func (m *BlogModel) Latest() ([]*Blog, error) {
-	stmt := `SELECT id, title, content, created, expires FROM blogs
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT ` + blogColumns + ` ` + blogFrom + `
+	WHERE ` + blogLive + ` ORDER BY b.id DESC LIMIT 10`
 
 	rows, err := m.DB.Query(stmt)
 	if err != nil {
@@ -133,16 +216,14 @@ func (m *BlogModel) Latest() ([]*Blog, error) {
 	blogs := []*Blog{} // pointer save memory compare to struct slice
 
 	for rows.Next() {
-		s := &Blog{}
-
 		/*
-			Use rows.Scan() to copy the values from each field in the row to the
-			new Snippet object that we created. Again, the arguments to row.Scan()
-			must be pointers to the place you want to copy the data into, and the
-			number of arguments must be exactly the same as the number of
+			scanBlog() uses rows.Scan() to copy the values from each field in
+			the row to a new Blog object. Again, the arguments to row.Scan()
+			must be pointers to the place you want to copy the data into, and
+			the number of arguments must be exactly the same as the number of
 			columns returned by your statement.
 		*/
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		s, err := scanBlog(rows)
 
 		if err != nil {
 			return nil, err
@@ -161,3 +242,347 @@ func (m *BlogModel) Latest() ([]*Blog, error) {
 
 	return blogs, nil
 }
+
+// This will return a page of live blogs, newest first. The limit and
+// offset let callers (like the JSON feed) walk through every blog instead of
+// just the 10 that Latest() gives back.
+func (m *BlogModel) Page(limit, offset int) ([]*Blog, error) {
+	stmt := `SELECT ` + blogColumns + ` ` + blogFrom + `
+	WHERE ` + blogLive + ` ORDER BY b.id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blogs := []*Blog{}
+
+	for rows.Next() {
+		s, err := scanBlog(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		blogs = append(blogs, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blogs, nil
+}
+
+// This will set the cover image of a blog, and its alt text. A mediaID of 0
+// takes the cover away.
+func (m *BlogModel) SetCover(blogID, mediaID int, alt string) error {
+	return setCover(m.DB, blogID, mediaID, alt)
+}
+
+// This will set the cover image of a blog like SetCover(), in the transaction
+// tx.
+func (m *BlogModel) SetCoverTx(tx *sql.Tx, blogID, mediaID int, alt string) error {
+	return setCover(tx, blogID, mediaID, alt)
+}
+
+func setCover(db execer, blogID, mediaID int, alt string) error {
+	var cover any
+	if mediaID != 0 {
+		cover = mediaID
+	}
+
+	_, err := db.Exec(`UPDATE blogs SET cover_id = ?, cover_alt = ?, modified = UTC_TIMESTAMP() WHERE id = ?`, cover, alt, blogID)
+	return err
+}
+
+/*
+	Modified
+	========
+		The page of a blog shows more than the blog: its images, tags,
+		series, translations, comments and reactions. Every method which
+		changes one of them also moves blogs.modified on with touchBlog()
+		(or in its own UPDATE), so the page can send a Last-Modified header
+		without asking every table when it last changed. Un-reacting and
+		approving an old comment leave no newer row behind, which is why
+		it's kept on the blog.
+*/
+
+// touchBlog() sets the modified time of a blog to now.
+func touchBlog(db execer, blogID int) error {
+	_, err := db.Exec(`UPDATE blogs SET modified = UTC_TIMESTAMP() WHERE id = ?`, blogID)
+	return err
+}
+
+// This will work out the word count, reading time and excerpt of every blog
+// again, expired ones too. It's for blogs written before they were saved, and
+// for when the way they're worked out changes. It returns the number of blogs.
+func (m *BlogModel) Resummarize() (int, error) {
+	rows, err := m.DB.Query(`SELECT id, content FROM blogs`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// Read them all first, so the updates don't wait for the result set.
+	contents := map[int]string{}
+
+	for rows.Next() {
+		var id int
+		var content string
+
+		if err := rows.Scan(&id, &content); err != nil {
+			return 0, err
+		}
+		contents[id] = content
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, content := range contents {
+		sum := summary.Of(content)
+
+		_, err := m.DB.Exec(`UPDATE blogs SET word_count = ?, reading_time = ?, excerpt = ?, modified = UTC_TIMESTAMP() WHERE id = ?`,
+			sum.Words, sum.ReadingTime, sum.Excerpt, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(contents), nil
+}
+
+// BlogFilter picks the blogs Search() returns. Empty fields don't filter.
+type BlogFilter struct {
+	Query  string // a part of the title
+	Status string // "live", "expired" or "draft"
+	Lang   string
+}
+
+// This will return a page of blogs which pass the filter, expired ones and
+// drafts too, newest first, and how many there are in all.
+func (m *BlogModel) Search(filter BlogFilter, limit, offset int) ([]*Blog, int, error) {
+	where := []string{"1 = 1"}
+	args := []any{}
+
+	if filter.Query != "" {
+		// Escape the wildcards of LIKE, so a % in the query is just a %.
+		q := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.Query)
+		where = append(where, "b.title LIKE ?")
+		args = append(args, "%"+q+"%")
+	}
+	switch filter.Status {
+	case "live":
+		where = append(where, blogLive)
+	case "expired":
+		where = append(where, "b.published AND b.expires <= UTC_TIMESTAMP()")
+	case "draft":
+		where = append(where, "NOT b.published")
+	}
+	if filter.Lang != "" {
+		where = append(where, "b.lang = ?")
+		args = append(args, filter.Lang)
+	}
+
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM blogs b WHERE `+cond, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stmt := `SELECT ` + blogColumns + ` ` + blogFrom + ` WHERE ` + cond + ` ORDER BY b.id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	blogs := []*Blog{}
+
+	for rows.Next() {
+		b, err := scanBlog(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		blogs = append(blogs, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return blogs, total, nil
+}
+
+// This will delete the given blogs, with everything that belongs to them
+// (comments, translations, reactions and so on go with the foreign keys).
+func (m *BlogModel) Delete(blogIDs []int) error {
+	if len(blogIDs) == 0 {
+		return nil
+	}
+
+	stmt := `DELETE FROM blogs WHERE id IN (?` + strings.Repeat(", ?", len(blogIDs)-1) + `)`
+
+	args := make([]any, len(blogIDs))
+	for i, id := range blogIDs {
+		args[i] = id
+	}
+
+	_, err := m.DB.Exec(stmt, args...)
+	return err
+}
+
+// This will move the expiry of the given blogs days further. A blog which has
+// expired already gets days from now, so it comes back for that long.
+func (m *BlogModel) Extend(blogIDs []int, days int) error {
+	if len(blogIDs) == 0 {
+		return nil
+	}
+
+	stmt := `UPDATE blogs SET expires = DATE_ADD(GREATEST(expires, UTC_TIMESTAMP()), INTERVAL ? DAY),
+	modified = UTC_TIMESTAMP() WHERE id IN (?` + strings.Repeat(", ?", len(blogIDs)-1) + `)`
+
+	args := []any{days}
+	for _, id := range blogIDs {
+		args = append(args, id)
+	}
+
+	_, err := m.DB.Exec(stmt, args...)
+	return err
+}
+
+// This will publish the given blogs, or turn them into drafts when published
+// is false. Drafts keep their expiry, a draft which is published after it
+// expired stays expired until it's extended.
+func (m *BlogModel) SetPublished(blogIDs []int, published bool) error {
+	if len(blogIDs) == 0 {
+		return nil
+	}
+
+	stmt := `UPDATE blogs SET published = ?, modified = UTC_TIMESTAMP()
+	WHERE id IN (?` + strings.Repeat(", ?", len(blogIDs)-1) + `)`
+
+	args := []any{published}
+	for _, id := range blogIDs {
+		args = append(args, id)
+	}
+
+	_, err := m.DB.Exec(stmt, args...)
+	return err
+}
+
+// This will set the tags of a blog, replacing the ones it had.
+func (m *BlogModel) SetTags(blogID int, tags []string) error {
+	return inTx(m.DB, func(tx *sql.Tx) error {
+		return m.SetTagsTx(tx, blogID, tags)
+	})
+}
+
+// This will set the tags of a blog like SetTags(), in the transaction tx.
+func (m *BlogModel) SetTagsTx(tx *sql.Tx, blogID int, tags []string) error {
+	_, err := tx.Exec(`DELETE FROM blog_tags WHERE blog_id = ?`, blogID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err = tx.Exec(`INSERT IGNORE INTO blog_tags (blog_id, tag) VALUES(?, ?)`, blogID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return touchBlog(tx, blogID)
+}
+
+// This will return the tags of the given blogs, by blog ID and in alphabetical
+// order. Blogs without tags aren't in the map.
+func (m *BlogModel) TagsFor(blogIDs []int) (map[int][]string, error) {
+	tags := map[int][]string{}
+	if len(blogIDs) == 0 {
+		return tags, nil
+	}
+
+	// One placeholder for every blog: IN (?, ?, ?).
+	stmt := `SELECT blog_id, tag FROM blog_tags WHERE blog_id IN (?` +
+		strings.Repeat(", ?", len(blogIDs)-1) + `) ORDER BY tag`
+
+	args := make([]any, len(blogIDs))
+	for i, id := range blogIDs {
+		args[i] = id
+	}
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var tag string
+
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+
+		tags[id] = append(tags[id], tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// This will return the number of live blogs.
+func (m *BlogModel) Count() (int, error) {
+	stmt := `SELECT COUNT(*) FROM blogs b WHERE ` + blogLive
+
+	var count int
+	err := m.DB.QueryRow(stmt).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// This will return a page of live blogs, oldest first, with only the
+// ID, Lang, Created and Expires fields filled in. It's used where we need to
+// list every blog (like the sitemap) and don't want to load all of the content.
+func (m *BlogModel) Timestamps(limit, offset int) ([]*Blog, error) {
+	stmt := `SELECT b.id, b.lang, b.created, b.expires FROM blogs b
+	WHERE ` + blogLive + ` ORDER BY b.id LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blogs := []*Blog{}
+
+	for rows.Next() {
+		s := &Blog{}
+
+		err := rows.Scan(&s.ID, &s.Lang, &s.Created, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+
+		blogs = append(blogs, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blogs, nil
+}
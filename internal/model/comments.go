@@ -0,0 +1,214 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/*
+	Comments
+	========
+		Readers can comment on a blog, and reply to a comment. Replies only go
+		one level deep: a reply to a reply is stored as a reply to the same
+		top level comment, so a thread is a comment with a flat list of replies.
+
+		Every comment starts out pending and is only shown on the blog once a
+		moderator approved it. Rejected and spam comments are kept, so the
+		moderation queue can show what was already turned down.
+*/
+
+// The statuses a comment can have.
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentRejected = "rejected"
+	CommentSpam     = "spam"
+)
+
+type Comment struct {
+	ID       int
+	BlogID   int
+	ParentID int // 0 for a top level comment
+	Name     string
+	Content  string
+	Status   string
+	Created  time.Time
+
+	// Replies holds the approved replies of a top level comment. It's only
+	// filled in by ForBlog().
+	Replies []*Comment
+
+	// BlogTitle is the title of the blog the comment is on. It's only filled
+	// in by Pending(), for the moderation queue.
+	BlogTitle string
+}
+
+// Define a CommentModel type which wraps a sql.DB connection pool.
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// This will insert a new comment into the database, with the status the spam
+// filter gave it. When parentID is the ID of a reply, the comment becomes a
+// reply to that reply's parent.
+func (m *CommentModel) Insert(blogID, parentID int, name, content, status string) (int, error) {
+	var parent sql.NullInt64
+
+	if parentID > 0 {
+		p, err := m.Get(parentID)
+		if err != nil {
+			return 0, err
+		}
+		if p.BlogID != blogID || p.Status != CommentApproved {
+			return 0, ErrNoRecord
+		}
+		if p.ParentID > 0 {
+			parentID = p.ParentID
+		}
+		parent = sql.NullInt64{Int64: int64(parentID), Valid: true}
+	}
+
+	stmt := `INSERT INTO comments (blog_id, parent_id, name, content, status, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, blogID, parent, name, content, status)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Only approved comments are on the page of the blog.
+	if status == CommentApproved {
+		if err := touchBlog(m.DB, blogID); err != nil {
+			return 0, err
+		}
+	}
+	return int(id), nil
+}
+
+// This will return a specific comment based on its id, whatever its status.
+func (m *CommentModel) Get(id int) (*Comment, error) {
+	stmt := `SELECT id, blog_id, parent_id, name, content, status, created
+	FROM comments WHERE id = ?`
+
+	c := &Comment{}
+	var parent sql.NullInt64
+
+	err := m.DB.QueryRow(stmt, id).Scan(&c.ID, &c.BlogID, &parent, &c.Name, &c.Content, &c.Status, &c.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	c.ParentID = int(parent.Int64)
+
+	return c, nil
+}
+
+// This will return the approved comments of a blog as threads, oldest first.
+func (m *CommentModel) ForBlog(blogID int) ([]*Comment, error) {
+	stmt := `SELECT id, blog_id, parent_id, name, content, status, created
+	FROM comments WHERE blog_id = ? AND status = ? ORDER BY id`
+
+	rows, err := m.DB.Query(stmt, blogID, CommentApproved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []*Comment{}
+	byID := map[int]*Comment{}
+
+	for rows.Next() {
+		c := &Comment{}
+		var parent sql.NullInt64
+
+		err := rows.Scan(&c.ID, &c.BlogID, &parent, &c.Name, &c.Content, &c.Status, &c.Created)
+		if err != nil {
+			return nil, err
+		}
+		c.ParentID = int(parent.Int64)
+
+		// Replies always come after their parent because they have a bigger
+		// id. A reply whose parent isn't approved (any more) isn't shown.
+		if c.ParentID == 0 {
+			threads = append(threads, c)
+			byID[c.ID] = c
+		} else if p, ok := byID[c.ParentID]; ok {
+			p.Replies = append(p.Replies, c)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+// This will return the comments waiting for a moderator, oldest first.
+func (m *CommentModel) Pending(limit int) ([]*Comment, error) {
+	stmt := `SELECT c.id, c.blog_id, c.parent_id, c.name, c.content, c.status, c.created, b.title
+	FROM comments c INNER JOIN blogs b ON b.id = c.blog_id
+	WHERE c.status = ? ORDER BY c.id LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, CommentPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+
+	for rows.Next() {
+		c := &Comment{}
+		var parent sql.NullInt64
+
+		err := rows.Scan(&c.ID, &c.BlogID, &parent, &c.Name, &c.Content, &c.Status, &c.Created, &c.BlogTitle)
+		if err != nil {
+			return nil, err
+		}
+		c.ParentID = int(parent.Int64)
+
+		comments = append(comments, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// This will set the status of a pending comment and record which moderator
+// did it. A comment which was moderated already is left alone, and
+// ErrModerated is returned.
+func (m *CommentModel) Moderate(id int, status, moderator string) error {
+	stmt := `UPDATE comments SET status = ?, moderated_by = ?, moderated = UTC_TIMESTAMP()
+	WHERE id = ? AND status = ?`
+
+	result, err := m.DB.Exec(stmt, status, moderator, id, CommentPending)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrModerated
+	}
+
+	if status == CommentApproved {
+		_, err = m.DB.Exec(`UPDATE blogs SET modified = UTC_TIMESTAMP()
+		WHERE id = (SELECT blog_id FROM comments WHERE id = ?)`, id)
+	}
+	return err
+}
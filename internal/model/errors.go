@@ -2,4 +2,18 @@ package model
 
 import "errors"
 
-var ErrNoRecord = errors.New("models: no matching record found")
\ No newline at end of file
+var (
+	ErrNoRecord = errors.New("models: no matching record found")
+
+	// ErrDuplicateSlug is returned when another translation in the same
+	// language, or another series, already uses the slug.
+	ErrDuplicateSlug = errors.New("models: duplicate slug")
+
+	// ErrDuplicateTranslation is returned when the blog already has a
+	// translation in the language.
+	ErrDuplicateTranslation = errors.New("models: duplicate translation")
+
+	// ErrModerated is returned when a comment isn't pending anymore, because
+	// a moderator has already approved or rejected it.
+	ErrModerated = errors.New("models: comment already moderated")
+)
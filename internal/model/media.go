@@ -0,0 +1,166 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+/*
+	Define a Media type to hold an uploaded image. The files themselves are
+	in the storage (see internal/storage), under keys made from the Hash,
+	the database only knows what's there. The same image uploaded twice
+	has the same hash, so it's stored once and both uploads get the same
+	Media.
+*/
+
+type Media struct {
+	ID          int
+	Hash        string
+	Name        string // the file name it was uploaded with
+	ContentType string // the type of the served files, image/jpeg or image/png
+	Width       int
+	Height      int
+	Size        int64 // the size of the upload in bytes
+	Created     time.Time
+}
+
+// Define a MediaModel type which wraps a sql.DB connection pool.
+type MediaModel struct {
+	DB *sql.DB
+}
+
+// The columns of the media table, in the order scanMedia() reads them.
+const mediaColumns = `id, hash, name, content_type, width, height, size, created`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMedia(s scanner) (*Media, error) {
+	m := &Media{}
+	err := s.Scan(&m.ID, &m.Hash, &m.Name, &m.ContentType, &m.Width, &m.Height, &m.Size, &m.Created)
+	return m, err
+}
+
+// This will insert a new image into the database. When an image with the same
+// hash is already there it returns that one instead.
+func (m *MediaModel) Insert(media *Media) (*Media, error) {
+	stmt := `INSERT INTO media (hash, name, content_type, width, height, size, created)
+	VALUES(?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, media.Hash, media.Name, media.ContentType, media.Width, media.Height, media.Size)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if !errors.As(err, &mySQLError) || mySQLError.Number != 1062 {
+			return nil, err
+		}
+	}
+
+	return m.GetByHash(media.Hash)
+}
+
+// This will return a specific image based on its id.
+func (m *MediaModel) Get(id int) (*Media, error) {
+	media, err := scanMedia(m.DB.QueryRow(`SELECT `+mediaColumns+` FROM media WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return media, nil
+}
+
+// This will return the image with the given hash.
+func (m *MediaModel) GetByHash(hash string) (*Media, error) {
+	media, err := scanMedia(m.DB.QueryRow(`SELECT `+mediaColumns+` FROM media WHERE hash = ?`, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return media, nil
+}
+
+// This will return limit images, newest first, skipping the first offset.
+func (m *MediaModel) Page(limit, offset int) ([]*Media, error) {
+	return m.query(`SELECT `+mediaColumns+` FROM media ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+}
+
+// This will return the size of every upload in the library added up, in bytes.
+func (m *MediaModel) TotalSize() (int64, error) {
+	var n int64
+	err := m.DB.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM media`).Scan(&n)
+	return n, err
+}
+
+// This will return the number of images.
+func (m *MediaModel) Count() (int, error) {
+	var n int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM media`).Scan(&n)
+	return n, err
+}
+
+// This will return the images of a blog, in the order they were added.
+func (m *MediaModel) ForBlog(blogID int) ([]*Media, error) {
+	stmt := `SELECT m.id, m.hash, m.name, m.content_type, m.width, m.height, m.size, m.created
+	FROM media m INNER JOIN blog_media bm ON bm.media_id = m.id
+	WHERE bm.blog_id = ? ORDER BY bm.position`
+
+	return m.query(stmt, blogID)
+}
+
+// This will add images to a blog, after the ones it already has. Images it
+// already has are left where they are.
+func (m *MediaModel) Attach(blogID int, mediaIDs []int) error {
+	return inTx(m.DB, func(tx *sql.Tx) error {
+		return m.AttachTx(tx, blogID, mediaIDs)
+	})
+}
+
+// This will add images to a blog like Attach(), in the transaction tx.
+func (m *MediaModel) AttachTx(tx *sql.Tx, blogID int, mediaIDs []int) error {
+	var position int
+	err := tx.QueryRow(`SELECT COALESCE(MAX(position), 0) FROM blog_media WHERE blog_id = ?`, blogID).Scan(&position)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range mediaIDs {
+		position++
+		_, err = tx.Exec(`INSERT IGNORE INTO blog_media (blog_id, media_id, position) VALUES(?, ?, ?)`, blogID, id, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	return touchBlog(tx, blogID)
+}
+
+func (m *MediaModel) query(stmt string, args ...any) ([]*Media, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Media{}
+
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, media)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
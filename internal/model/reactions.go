@@ -0,0 +1,181 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+)
+
+/*
+	Reactions
+	=========
+		A visitor can react to a blog with each kind of reaction (like,
+		love...) once. The reactions table remembers who reacted with what,
+		so nobody can push a count up by clicking again, and the
+		reaction_counts table keeps the totals, so showing them never has to
+		count the rows of reactions. Both are changed in one transaction, so
+		the totals can't drift from the reactions.
+
+		Every reaction also keeps the fingerprint of the visitor, the daily
+		hash of their IP address and User-Agent (see cmd/web/analytics.go),
+		so a new session for every click doesn't add a reaction again on
+		the same day.
+*/
+
+// Define a ReactionModel type which wraps a sql.DB connection pool.
+type ReactionModel struct {
+	DB *sql.DB
+}
+
+// This will add the reaction of a visitor to a blog, or take it away when
+// they had already reacted with that kind. It returns true when the reaction
+// was added.
+//
+// The fingerprint is a second way to tell visitors apart, for somebody who
+// throws their session away after every click: a reaction isn't added when
+// another visitor with the same fingerprint already gave it.
+func (m *ReactionModel) Toggle(blogID int, visitor, fingerprint, kind string) (bool, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	// Rollback() does nothing once Commit() succeeded.
+	defer tx.Rollback()
+
+	// Take the reaction away if the visitor had it.
+	result, err := tx.Exec(`DELETE FROM reactions WHERE blog_id = ? AND visitor = ? AND kind = ?`, blogID, visitor, kind)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if n == 1 {
+		_, err = tx.Exec(`UPDATE reaction_counts SET count = count - 1
+		WHERE blog_id = ? AND kind = ? AND count > 0`, blogID, kind)
+		if err != nil {
+			return false, err
+		}
+		if err := touchBlog(tx, blogID); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	// Otherwise add it, unless the fingerprint gave it already. INSERT
+	// IGNORE also doesn't insert anything when another click of the same
+	// visitor got in first (the primary key).
+	result, err = tx.Exec(`INSERT IGNORE INTO reactions (blog_id, visitor, kind, fingerprint, created)
+	SELECT ?, ?, ?, ?, UTC_TIMESTAMP() FROM DUAL
+	WHERE NOT EXISTS (SELECT 1 FROM reactions WHERE blog_id = ? AND kind = ? AND fingerprint = ?)`,
+		blogID, visitor, kind, fingerprint, blogID, kind, fingerprint)
+	if err != nil {
+		return false, err
+	}
+
+	n, err = result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, tx.Commit()
+	}
+
+	_, err = tx.Exec(`INSERT INTO reaction_counts (blog_id, kind, count) VALUES(?, ?, 1)
+	ON DUPLICATE KEY UPDATE count = count + 1`, blogID, kind)
+	if err != nil {
+		return false, err
+	}
+
+	if err := touchBlog(tx, blogID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// This will return the reaction counts of a blog, by kind. Kinds nobody
+// reacted with are left out.
+func (m *ReactionModel) Counts(blogID int) (map[string]int, error) {
+	all, err := m.CountsFor([]int{blogID})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := all[blogID]
+	if counts == nil {
+		counts = map[string]int{}
+	}
+	return counts, nil
+}
+
+// This will return the reaction counts of several blogs at once, by blog ID
+// and kind, for lists of blogs like the home page.
+func (m *ReactionModel) CountsFor(blogIDs []int) (map[int]map[string]int, error) {
+	counts := map[int]map[string]int{}
+	if len(blogIDs) == 0 {
+		return counts, nil
+	}
+
+	// One placeholder for every blog: IN (?, ?, ?).
+	stmt := `SELECT blog_id, kind, count FROM reaction_counts WHERE count > 0 AND blog_id IN (?` +
+		strings.Repeat(", ?", len(blogIDs)-1) + `)`
+
+	args := make([]any, len(blogIDs))
+	for i, id := range blogIDs {
+		args[i] = id
+	}
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		var kind string
+
+		if err := rows.Scan(&id, &kind, &count); err != nil {
+			return nil, err
+		}
+
+		if counts[id] == nil {
+			counts[id] = map[string]int{}
+		}
+		counts[id][kind] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// This will return the kinds of reaction a visitor gave a blog.
+func (m *ReactionModel) Mine(blogID int, visitor string) ([]string, error) {
+	rows, err := m.DB.Query(`SELECT kind FROM reactions WHERE blog_id = ? AND visitor = ?`, blogID, visitor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kinds := []string{}
+
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return kinds, nil
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/munnaMia/Story-Book/internal/related"
+)
+
+/*
+	Related blogs are worked out in the background (see cmd/web/related.go)
+	and kept in related_blogs, so showing them on a blog page is a single
+	query. Every blog has a few rows there, one for every blog related to
+	it, with the score of the pair.
+*/
+
+// Define a RelatedModel type which wraps a sql.DB connection pool.
+type RelatedModel struct {
+	DB *sql.DB
+}
+
+// This will return every live blog with its tags, as the documents of
+// a related.Index.
+func (m *RelatedModel) Docs() ([]related.Doc, error) {
+	rows, err := m.DB.Query(`SELECT b.id, b.title, b.content FROM blogs b WHERE ` + blogLive + ` ORDER BY b.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []related.Doc{}
+	index := map[int]int{}
+
+	for rows.Next() {
+		var d related.Doc
+
+		err := rows.Scan(&d.ID, &d.Title, &d.Text)
+		if err != nil {
+			return nil, err
+		}
+
+		index[d.ID] = len(docs)
+		docs = append(docs, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The tags of the expired blogs and drafts are read as well, it's
+	// simpler than joining blogs again, and they're left out below.
+	tagRows, err := m.DB.Query(`SELECT blog_id, tag FROM blog_tags`)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		var id int
+		var tag string
+
+		if err := tagRows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+
+		if i, ok := index[id]; ok {
+			docs[i].Tags = append(docs[i].Tags, tag)
+		}
+	}
+
+	if err := tagRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return docs, nil
+}
+
+// This will return the related blogs of every blog, best first.
+func (m *RelatedModel) All() (map[int][]related.Match, error) {
+	rows, err := m.DB.Query(`SELECT blog_id, related_id, score FROM related_blogs ORDER BY blog_id, score DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := map[int][]related.Match{}
+
+	for rows.Next() {
+		var id int
+		var match related.Match
+
+		if err := rows.Scan(&id, &match.ID, &match.Score); err != nil {
+			return nil, err
+		}
+
+		all[id] = append(all[id], match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return all, nil
+}
+
+// This will set the related blogs of a blog, replacing the ones it had.
+func (m *RelatedModel) Set(blogID int, matches []related.Match) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback() does nothing once Commit() succeeded.
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM related_blogs WHERE blog_id = ?`, blogID)
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		_, err = tx.Exec(`INSERT INTO related_blogs (blog_id, related_id, score) VALUES(?, ?, ?)`, blogID, match.ID, match.Score)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := touchBlog(tx, blogID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// This will return up to limit live blogs related to a blog, best
+// first.
+func (m *RelatedModel) ForBlog(blogID, limit int) ([]*Blog, error) {
+	stmt := `SELECT ` + blogColumns + ` ` + blogFrom + `
+	INNER JOIN related_blogs r ON r.related_id = b.id
+	WHERE r.blog_id = ? AND ` + blogLive + ` ORDER BY r.score DESC, b.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, blogID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blogs := []*Blog{}
+
+	for rows.Next() {
+		b, err := scanBlog(rows)
+		if err != nil {
+			return nil, err
+		}
+		blogs = append(blogs, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blogs, nil
+}
@@ -0,0 +1,365 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+/*
+	Define a Series type to hold an ordered group of blogs, like the parts
+	of a tutorial. A blog can be in one series at most. series_blogs keeps
+	the position of each blog, and Blogs has the blogs which are live
+	(published and not expired), in that order.
+*/
+
+type Series struct {
+	ID          int
+	Slug        string
+	Title       string
+	Description string
+	Created     time.Time
+	Blogs       []*Blog
+}
+
+// Define a SeriesModel type which wraps a sql.DB connection pool.
+type SeriesModel struct {
+	DB *sql.DB
+}
+
+// This will insert a new, empty series into the database.
+func (m *SeriesModel) Insert(slug, title, description string) (int, error) {
+	return insertSeries(m.DB, slug, title, description)
+}
+
+// This will insert a new series like Insert(), in the transaction tx.
+func (m *SeriesModel) InsertTx(tx *sql.Tx, slug, title, description string) (int, error) {
+	return insertSeries(tx, slug, title, description)
+}
+
+func insertSeries(db execer, slug, title, description string) (int, error) {
+	stmt := `INSERT INTO series (slug, title, description, created)
+	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := db.Exec(stmt, slug, title, description)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "series_uc_slug") {
+			return 0, ErrDuplicateSlug
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// This will change the title and description of a series.
+func (m *SeriesModel) Update(id int, title, description string) error {
+	return updateSeries(m.DB, id, title, description)
+}
+
+// This will change the title and description of a series like Update(), in
+// the transaction tx.
+func (m *SeriesModel) UpdateTx(tx *sql.Tx, id int, title, description string) error {
+	return updateSeries(tx, id, title, description)
+}
+
+func updateSeries(db execer, id int, title, description string) error {
+	_, err := db.Exec(`UPDATE series SET title = ?, description = ? WHERE id = ?`, title, description, id)
+	if err != nil {
+		return err
+	}
+	return touchSeries(db, id)
+}
+
+// touchSeries() sets the modified time of every blog of a series to now. The
+// pages of all of them show the table of contents of the series.
+func touchSeries(db execer, seriesID int) error {
+	_, err := db.Exec(`UPDATE blogs SET modified = UTC_TIMESTAMP()
+	WHERE id IN (SELECT blog_id FROM series_blogs WHERE series_id = ?)`, seriesID)
+	return err
+}
+
+// This will return a specific series based on its id, without its blogs.
+func (m *SeriesModel) Get(id int) (*Series, error) {
+	s := &Series{}
+
+	err := m.DB.QueryRow(`SELECT id, slug, title, description, created FROM series WHERE id = ?`, id).
+		Scan(&s.ID, &s.Slug, &s.Title, &s.Description, &s.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// This will return the series with the given slug, with its blogs.
+func (m *SeriesModel) GetBySlug(slug string) (*Series, error) {
+	s := &Series{}
+
+	err := m.DB.QueryRow(`SELECT id, slug, title, description, created FROM series WHERE slug = ?`, slug).
+		Scan(&s.ID, &s.Slug, &s.Title, &s.Description, &s.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	s.Blogs, err = m.blogs(s.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// This will return the series a blog is in, with its blogs. A blog which isn't
+// in a series gives ErrNoRecord.
+func (m *SeriesModel) ForBlog(blogID int) (*Series, error) {
+	stmt := `SELECT s.id, s.slug, s.title, s.description, s.created
+	FROM series s INNER JOIN series_blogs sb ON sb.series_id = s.id
+	WHERE sb.blog_id = ?`
+
+	s := &Series{}
+
+	err := m.DB.QueryRow(stmt, blogID).Scan(&s.ID, &s.Slug, &s.Title, &s.Description, &s.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	s.Blogs, err = m.blogs(s.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// This will return every series, ordered by title, without their blogs.
+func (m *SeriesModel) All() ([]*Series, error) {
+	rows, err := m.DB.Query(`SELECT id, slug, title, description, created FROM series ORDER BY title`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Series{}
+
+	for rows.Next() {
+		s := &Series{}
+
+		err := rows.Scan(&s.ID, &s.Slug, &s.Title, &s.Description, &s.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// This will return every series which has a live blog, oldest first, without
+// their blogs. The series without any are empty pages, which the sitemap
+// leaves out.
+func (m *SeriesModel) Listed() ([]*Series, error) {
+	stmt := `SELECT s.id, s.slug, s.title, s.description, s.created FROM series s
+	WHERE EXISTS (SELECT 1 FROM series_blogs sb INNER JOIN blogs b ON b.id = sb.blog_id
+		WHERE sb.series_id = s.id AND ` + blogLive + `)
+	ORDER BY s.id`
+
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Series{}
+
+	for rows.Next() {
+		s := &Series{}
+
+		err := rows.Scan(&s.ID, &s.Slug, &s.Title, &s.Description, &s.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// This will add a blog to a series as its part number position, moving the
+// blogs from there on one place down. A position of 0 (or past the end) adds it
+// at the end. A blog which is in another series is moved out of it.
+func (m *SeriesModel) Add(seriesID, blogID, position int) error {
+	return inTx(m.DB, func(tx *sql.Tx) error {
+		return m.AddTx(tx, seriesID, blogID, position)
+	})
+}
+
+// This will add a blog to a series like Add(), in the transaction tx.
+func (m *SeriesModel) AddTx(tx *sql.Tx, seriesID, blogID, position int) error {
+	// The blogs of the series it leaves show it in their contents too.
+	var old int
+	err := tx.QueryRow(`SELECT series_id FROM series_blogs WHERE blog_id = ?`, blogID).Scan(&old)
+	if err == nil {
+		err = touchSeries(tx, old)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM series_blogs WHERE blog_id = ?`, blogID)
+	if err != nil {
+		return err
+	}
+
+	var last int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(position), 0) FROM series_blogs WHERE series_id = ?`, seriesID).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	if position < 1 || position > last {
+		position = last + 1
+	} else {
+		_, err = tx.Exec(`UPDATE series_blogs SET position = position + 1 WHERE series_id = ? AND position >= ?`, seriesID, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO series_blogs (series_id, blog_id, position) VALUES(?, ?, ?)`, seriesID, blogID, position)
+	if err != nil {
+		return err
+	}
+	return touchSeries(tx, seriesID)
+}
+
+// This will take the blogs in remove out of a series, and put the blogs of
+// blogIDs in that order, in the places those blogs had. Blogs of the series
+// which aren't in blogIDs, like the expired ones and drafts the edit page doesn't show,
+// keep their places.
+func (m *SeriesModel) Reorder(seriesID int, blogIDs, remove []int) error {
+	return inTx(m.DB, func(tx *sql.Tx) error {
+		return m.ReorderTx(tx, seriesID, blogIDs, remove)
+	})
+}
+
+// This will reorder the blogs of a series like Reorder(), in the transaction
+// tx.
+func (m *SeriesModel) ReorderTx(tx *sql.Tx, seriesID int, blogIDs, remove []int) error {
+	for _, id := range remove {
+		_, err := tx.Exec(`DELETE FROM series_blogs WHERE series_id = ? AND blog_id = ?`, seriesID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query(`SELECT blog_id FROM series_blogs WHERE series_id = ? ORDER BY position`, seriesID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		current = append(current, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// Only the blogs which are in the series are moved, once each.
+	var listed []int
+	for _, id := range blogIDs {
+		if slices.Contains(current, id) && !slices.Contains(listed, id) {
+			listed = append(listed, id)
+		}
+	}
+
+	// Fill the places of the listed blogs with them in their new order,
+	// and number the parts from 1 again, without the gaps of the removed
+	// ones.
+	next := 0
+	for i, id := range current {
+		if slices.Contains(listed, id) {
+			current[i] = listed[next]
+			next++
+		}
+	}
+
+	for i, id := range current {
+		_, err = tx.Exec(`UPDATE series_blogs SET position = ? WHERE series_id = ? AND blog_id = ?`, i+1, seriesID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The blogs which were taken out aren't in the series anymore.
+	for _, id := range remove {
+		if err := touchBlog(tx, id); err != nil {
+			return err
+		}
+	}
+	return touchSeries(tx, seriesID)
+}
+
+// blogs() returns the live blogs of a series, in order.
+func (m *SeriesModel) blogs(seriesID int) ([]*Blog, error) {
+	stmt := `SELECT ` + blogColumns + ` ` + blogFrom + `
+	INNER JOIN series_blogs sb ON sb.blog_id = b.id
+	WHERE sb.series_id = ? AND ` + blogLive + ` ORDER BY sb.position`
+
+	rows, err := m.DB.Query(stmt, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blogs := []*Blog{}
+
+	for rows.Next() {
+		b, err := scanBlog(rows)
+		if err != nil {
+			return nil, err
+		}
+		blogs = append(blogs, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blogs, nil
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/munnaMia/Story-Book/internal/spam"
+)
+
+/*
+	Define a SpamModel type which stores what the Bayesian spam classifier
+	learned from the moderators (see internal/spam). The spam_tokens table
+	has a row for every word with the number of spam and ham texts it was
+	seen in, and the single row of spam_totals counts the texts themselves.
+*/
+
+type SpamModel struct {
+	DB *sql.DB
+}
+
+// This will return the counts of the tokens, and the number of spam and ham
+// texts learned from. Tokens never seen before are left out of the map.
+func (m *SpamModel) Counts(tokens []string) (map[string]spam.TokenCount, int, int, error) {
+	var spamDocs, hamDocs int
+
+	err := m.DB.QueryRow(`SELECT spam, ham FROM spam_totals WHERE id = 1`).Scan(&spamDocs, &hamDocs)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, 0, err
+	}
+
+	counts := map[string]spam.TokenCount{}
+	if len(tokens) == 0 {
+		return counts, spamDocs, hamDocs, nil
+	}
+
+	// One placeholder for every token: IN (?, ?, ?).
+	stmt := `SELECT token, spam, ham FROM spam_tokens WHERE token IN (?` +
+		strings.Repeat(", ?", len(tokens)-1) + `)`
+
+	args := make([]any, len(tokens))
+	for i, t := range tokens {
+		args[i] = t
+	}
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+		var c spam.TokenCount
+
+		if err := rows.Scan(&token, &c.Spam, &c.Ham); err != nil {
+			return nil, 0, 0, err
+		}
+		counts[token] = c
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return counts, spamDocs, hamDocs, nil
+}
+
+// This will add one text, split into tokens, to the counts. It runs in a
+// transaction so the totals always match the token counts.
+func (m *SpamModel) Learn(tokens []string, isSpam bool) error {
+	column := "ham"
+	if isSpam {
+		column = "spam"
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback() does nothing once Commit() succeeded.
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO spam_totals (id, ` + column + `) VALUES (1, 1)
+	ON DUPLICATE KEY UPDATE ` + column + ` = ` + column + ` + 1`)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		_, err = tx.Exec(`INSERT INTO spam_tokens (token, `+column+`) VALUES (?, 1)
+		ON DUPLICATE KEY UPDATE `+column+` = `+column+` + 1`, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
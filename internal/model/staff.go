@@ -0,0 +1,95 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+)
+
+/*
+	Staff
+	=====
+		The moderators log in with the names and passwords of the -moderators
+		flag, there are no accounts in the database. The staff table only
+		keeps what the admins change on the dashboard: the role of a
+		moderator, and whether they're disabled. A moderator without a row
+		is an enabled moderator.
+*/
+
+// The roles a moderator can have. Admins can use the admin dashboard as well
+// as the moderation queue.
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+type Staff struct {
+	Name     string
+	Role     string
+	Disabled bool
+}
+
+// Define a StaffModel type which wraps a sql.DB connection pool.
+type StaffModel struct {
+	DB *sql.DB
+}
+
+// This will return the role and state of a moderator. A moderator the admins
+// never changed is an enabled moderator.
+func (m *StaffModel) Get(name string) (*Staff, error) {
+	s := &Staff{Name: name, Role: RoleModerator}
+
+	err := m.DB.QueryRow(`SELECT role, disabled FROM staff WHERE name = ?`, name).Scan(&s.Role, &s.Disabled)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// This will return every row of the staff table, by name.
+func (m *StaffModel) All() (map[string]*Staff, error) {
+	rows, err := m.DB.Query(`SELECT name, role, disabled FROM staff`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	staff := map[string]*Staff{}
+
+	for rows.Next() {
+		s := &Staff{}
+
+		if err := rows.Scan(&s.Name, &s.Role, &s.Disabled); err != nil {
+			return nil, err
+		}
+		staff[s.Name] = s
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return staff, nil
+}
+
+// This will set the role of a moderator and whether they're disabled.
+func (m *StaffModel) Set(name, role string, disabled bool) error {
+	stmt := `INSERT INTO staff (name, role, disabled) VALUES(?, ?, ?)
+	ON DUPLICATE KEY UPDATE role = VALUES(role), disabled = VALUES(disabled)`
+
+	_, err := m.DB.Exec(stmt, name, role, disabled)
+	return err
+}
+
+// Define a SessionModel type for the sessions table of scs, which the session
+// manager otherwise looks after by itself.
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// This will return the number of sessions which haven't expired.
+func (m *SessionModel) Active() (int, error) {
+	var count int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE expiry > UTC_TIMESTAMP(6)`).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+/*
+	Define a Translation type to hold a translation of a blog into another
+	language. The blog it belongs to is the canonical post, the translation
+	only has its own title, content and slug (the readable part of its URL).
+*/
+
+type Translation struct {
+	ID      int
+	BlogID  int
+	Lang    string
+	Slug    string
+	Title   string
+	Content string
+	Created time.Time
+}
+
+// Define a TranslationModel type which wraps a sql.DB connection pool.
+type TranslationModel struct {
+	DB *sql.DB
+}
+
+// This will insert a new translation of a blog into the database.
+func (m *TranslationModel) Insert(blogID int, lang, slug, title, content string) (int, error) {
+	stmt := `INSERT INTO blog_translations (blog_id, lang, slug, title, content, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, blogID, lang, slug, title, content)
+	if err != nil {
+		/*
+			If this returns an error, we use the errors.As() function to check
+			whether the error has the type *mysql.MySQLError. If it does, the
+			error will be assigned to the mySQLError variable. We can then check
+			whether or not the error relates to one of our unique constraints
+			by checking if the error code equals 1062 and the contents of the
+			error message string. If it does, we return one of our own errors.
+		*/
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 {
+			if strings.Contains(mySQLError.Message, "blog_translations_uc_lang_slug") {
+				return 0, ErrDuplicateSlug
+			}
+			if strings.Contains(mySQLError.Message, "blog_translations_uc_blog_lang") {
+				return 0, ErrDuplicateTranslation
+			}
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// The page of the blog links to its translations.
+	if err := touchBlog(m.DB, blogID); err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// This will return the translation with the given language and slug, as long
+// as the blog it belongs to is live.
+func (m *TranslationModel) GetBySlug(lang, slug string) (*Translation, error) {
+	stmt := `SELECT t.id, t.blog_id, t.lang, t.slug, t.title, t.content, t.created
+	FROM blog_translations t INNER JOIN blogs b ON b.id = t.blog_id
+	WHERE ` + blogLive + ` AND t.lang = ? AND t.slug = ?`
+
+	t := &Translation{}
+
+	err := m.DB.QueryRow(stmt, lang, slug).Scan(&t.ID, &t.BlogID, &t.Lang, &t.Slug, &t.Title, &t.Content, &t.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// This will return every translation of a blog, ordered by language.
+func (m *TranslationModel) ForBlog(blogID int) ([]*Translation, error) {
+	stmt := `SELECT id, blog_id, lang, slug, title, content, created
+	FROM blog_translations WHERE blog_id = ? ORDER BY lang`
+
+	rows, err := m.DB.Query(stmt, blogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*Translation{}
+
+	for rows.Next() {
+		t := &Translation{}
+
+		err := rows.Scan(&t.ID, &t.BlogID, &t.Lang, &t.Slug, &t.Title, &t.Content, &t.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		translations = append(translations, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return translations, nil
+}
+
+// This will return the translations of the given blogs, by blog ID and ordered
+// by language, without their content. Blogs without translations aren't in the
+// map.
+func (m *TranslationModel) ForBlogs(blogIDs []int) (map[int][]*Translation, error) {
+	translations := map[int][]*Translation{}
+	if len(blogIDs) == 0 {
+		return translations, nil
+	}
+
+	stmt := `SELECT id, blog_id, lang, slug, title, created FROM blog_translations
+	WHERE blog_id IN (?` + strings.Repeat(", ?", len(blogIDs)-1) + `) ORDER BY lang`
+
+	args := make([]any, len(blogIDs))
+	for i, id := range blogIDs {
+		args[i] = id
+	}
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := &Translation{}
+
+		err := rows.Scan(&t.ID, &t.BlogID, &t.Lang, &t.Slug, &t.Title, &t.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		translations[t.BlogID] = append(translations[t.BlogID], t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return translations, nil
+}
@@ -0,0 +1,44 @@
+package model
+
+import "database/sql"
+
+/*
+	Transactions
+	============
+		Most methods run their statements on the connection pool. Some also
+		have a Tx variant, which runs them in a transaction the caller
+		began instead, so a handler can save several things at once and
+		none of them when one fails:
+
+			tx, err := db.Begin()
+			...
+			defer tx.Rollback()
+
+			id, err := blogs.InsertTx(tx, ...)
+			err = blogs.SetTagsTx(tx, id, tags)
+			...
+			err = tx.Commit()
+
+		The Tx variants never commit or roll back themselves.
+*/
+
+// execer runs statements on the connection pool or in a transaction, so the
+// plain methods and their Tx variants can share their code.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// inTx() runs fn in a new transaction, and commits it when fn succeeds.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback() does nothing once Commit() succeeded.
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,216 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+/*
+	Page views
+	==========
+		Every page somebody reads is a row of page_views, written in batches
+		by cmd/web/analytics.go. There's nothing in a row which says who the
+		reader was: Visitor is a hash which changes every day, so it can
+		count the people of one day but can't follow anybody from one day to
+		the next.
+
+		The dashboard counts them by day, by blog and by referrer for the
+		last few days. Days are UTC days.
+
+		A batch is written with one statement, and one bad view fails all
+		of it. Most often that's the view of a blog which was deleted while
+		the view waited in the queue, so when the batch fails the views are
+		written one at a time, and one of a deleted blog is saved without
+		its blog. A view which still fails is left out, the others are
+		saved.
+*/
+
+type PageView struct {
+	Path     string
+	BlogID   int    // 0 for pages which aren't a blog
+	Visitor  string // the daily visitor hash
+	Referrer string // the host of the site the reader came from, "" for none
+	Created  time.Time
+}
+
+// DailyViews is the number of views and visitors of one day.
+type DailyViews struct {
+	Day      time.Time
+	Views    int
+	Visitors int
+}
+
+// BlogViews is the number of views and visitors of a blog.
+type BlogViews struct {
+	BlogID   int
+	Title    string
+	Views    int
+	Visitors int
+}
+
+// ReferrerViews is the number of views of readers coming from a site.
+type ReferrerViews struct {
+	Host  string
+	Views int
+}
+
+// Define a PageViewModel type which wraps a sql.DB connection pool.
+type PageViewModel struct {
+	DB *sql.DB
+}
+
+// insertViewStmt inserts one page view.
+const insertViewStmt = `INSERT INTO page_views (path, blog_id, visitor, referrer, created) VALUES (?, ?, ?, ?, ?)`
+
+// This will insert a batch of page views with one statement. If that fails
+// they're inserted one at a time, so one bad view doesn't lose the others.
+func (m *PageViewModel) Insert(views []PageView) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	// One group of placeholders for every view: VALUES (?, ?, ?, ?, ?), (?, ?, ?, ?, ?).
+	stmt := insertViewStmt + strings.Repeat(", (?, ?, ?, ?, ?)", len(views)-1)
+
+	args := make([]any, 0, len(views)*5)
+	for _, v := range views {
+		args = append(args, viewArgs(v)...)
+	}
+
+	_, err := m.DB.Exec(stmt, args...)
+	if err == nil {
+		return nil
+	}
+
+	failed := 0
+	for _, v := range views {
+		if err = m.insertOne(v); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("models: %d of %d page views not written, the last because: %w", failed, len(views), err)
+	}
+	return nil
+}
+
+// insertOne() inserts a single page view. When its blog doesn't exist anymore
+// it's inserted again without the blog.
+func (m *PageViewModel) insertOne(v PageView) error {
+	_, err := m.DB.Exec(insertViewStmt, viewArgs(v)...)
+
+	// Error 1452 is a failed foreign key: there's no blog v.BlogID.
+	var mySQLError *mysql.MySQLError
+	if v.BlogID != 0 && errors.As(err, &mySQLError) && mySQLError.Number == 1452 {
+		v.BlogID = 0
+		_, err = m.DB.Exec(insertViewStmt, viewArgs(v)...)
+	}
+	return err
+}
+
+// viewArgs() returns the values of the placeholders of insertViewStmt, with
+// NULL for a BlogID of 0.
+func viewArgs(v PageView) []any {
+	var blogID any
+	if v.BlogID != 0 {
+		blogID = v.BlogID
+	}
+	return []any{v.Path, blogID, v.Visitor, v.Referrer, v.Created}
+}
+
+// This will return the views and visitors of every day since the given time
+// which had any, oldest first. A blogID of 0 counts the views of every page.
+func (m *PageViewModel) Daily(since time.Time, blogID int) ([]DailyViews, error) {
+	stmt := `SELECT DATE(created) AS day, COUNT(*), COUNT(DISTINCT visitor) FROM page_views
+	WHERE created >= ? AND (? = 0 OR blog_id = ?) GROUP BY day ORDER BY day`
+
+	rows, err := m.DB.Query(stmt, since, blogID, blogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DailyViews{}
+
+	for rows.Next() {
+		var d DailyViews
+
+		if err := rows.Scan(&d.Day, &d.Views, &d.Visitors); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return days, nil
+}
+
+// This will return the limit blogs read most since the given time, most views
+// first. The visitor hash changes every day, so a visitor who came back on
+// another day is counted again.
+func (m *PageViewModel) TopBlogs(since time.Time, limit int) ([]BlogViews, error) {
+	stmt := `SELECT v.blog_id, b.title, COUNT(*), COUNT(DISTINCT v.visitor)
+	FROM page_views v INNER JOIN blogs b ON b.id = v.blog_id
+	WHERE v.created >= ? GROUP BY v.blog_id, b.title ORDER BY COUNT(*) DESC, v.blog_id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blogs := []BlogViews{}
+
+	for rows.Next() {
+		var b BlogViews
+
+		if err := rows.Scan(&b.BlogID, &b.Title, &b.Views, &b.Visitors); err != nil {
+			return nil, err
+		}
+		blogs = append(blogs, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blogs, nil
+}
+
+// This will return the limit sites most readers came from since the given
+// time, most views first.
+func (m *PageViewModel) TopReferrers(since time.Time, limit int) ([]ReferrerViews, error) {
+	stmt := `SELECT referrer, COUNT(*) FROM page_views
+	WHERE created >= ? AND referrer <> '' GROUP BY referrer ORDER BY COUNT(*) DESC, referrer LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrers := []ReferrerViews{}
+
+	for rows.Next() {
+		var r ReferrerViews
+
+		if err := rows.Scan(&r.Host, &r.Views); err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return referrers, nil
+}
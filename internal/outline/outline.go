@@ -0,0 +1,159 @@
+package outline
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+	Outline
+	=======
+		Blogs are plain text, but people write Markdown headings in them:
+
+			# Getting started
+			...
+			## Installing Go
+			...
+
+		Parse() splits the content at those headings, so view.html can show
+		them as real headings (with an id to link to) and the text between
+		them as before. The headings are also put into a tree for the table
+		of contents:
+
+			Getting started          #getting-started
+			    Installing Go        #installing-go
+			    Hello, world         #hello-world
+			Next steps               #next-steps
+
+		The id of a heading is made from its text, so links to a section
+		keep working as long as its heading doesn't change. Two headings
+		with the same text get -2, -3 and so on. Lines in ``` or ~~~ code
+		blocks are never headings, a # there is usually a comment.
+*/
+
+// Heading is a heading of the content, with the headings under it.
+type Heading struct {
+	Level    int // 1 for #, 2 for ## and so on
+	Text     string
+	ID       string
+	Children []*Heading
+}
+
+// Block is a heading or the text between two headings. Exactly one of them is
+// set.
+type Block struct {
+	Heading *Heading
+	Text    string
+}
+
+// Outline is the content of a blog split into blocks, and its headings as a
+// tree.
+type Outline struct {
+	Blocks   []Block
+	Headings []*Heading
+}
+
+// heading matches a Markdown heading. The # run closing a heading, as in
+// "## Install ##", is only taken off when there's a space before it, so
+// "# Learning C#" keeps its #.
+var heading = regexp.MustCompile(`^(#{1,6})\s+(.+?)(?:\s+#+)?\s*$`)
+
+// Parse() returns the outline of content. The headings don't get any of the
+// reserved ids, which the page uses for something else already.
+func Parse(content string, reserved ...string) *Outline {
+	o := &Outline{}
+
+	ids := map[string]bool{}
+	for _, id := range reserved {
+		ids[id] = true
+	}
+
+	// stack holds the last heading of every level above the current one,
+	// the next heading goes under the last one with a lower level.
+	var stack []*Heading
+
+	var text []string
+	code := false
+
+	flush := func() {
+		t := strings.Trim(strings.Join(text, "\n"), "\n")
+		if strings.TrimSpace(t) != "" {
+			o.Blocks = append(o.Blocks, Block{Text: t})
+		}
+		text = nil
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			code = !code
+		}
+
+		m := heading.FindStringSubmatch(line)
+		if code || m == nil {
+			text = append(text, line)
+			continue
+		}
+
+		flush()
+
+		h := &Heading{Level: len(m[1]), Text: m[2]}
+		h.ID = uniqueID(ids, anchor(h.Text))
+		o.Blocks = append(o.Blocks, Block{Heading: h})
+
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			o.Headings = append(o.Headings, h)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, h)
+		}
+		stack = append(stack, h)
+	}
+
+	flush()
+
+	return o
+}
+
+// anchor() makes an id from the text of a heading: the letters and digits in
+// lower case with a dash between the words, "Hello, World!" gives
+// "hello-world". Letters of any alphabet are kept.
+func anchor(text string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
+// uniqueID() returns id, or id-2, id-3 and so on when it's taken, and marks it
+// as taken. A heading without any letters or digits is a "section".
+func uniqueID(ids map[string]bool, id string) string {
+	if id == "" {
+		id = "section"
+	}
+
+	base := id
+	for n := 2; ids[id]; n++ {
+		id = base + "-" + strconv.Itoa(n)
+	}
+
+	ids[id] = true
+	return id
+}
@@ -0,0 +1,131 @@
+package outline
+
+import (
+	"strings"
+	"testing"
+)
+
+// tree() writes the headings of an outline one per line, indented by their
+// depth in the tree: "Getting started #getting-started".
+func tree(headings []*Heading, depth int, b *strings.Builder) {
+	for _, h := range headings {
+		b.WriteString(strings.Repeat("  ", depth) + h.Text + " #" + h.ID + "\n")
+		tree(h.Children, depth+1, b)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		reserved []string
+		headings string
+		blocks   int
+	}{
+		{
+			name:     "no headings",
+			content:  "Just some text.\n\nAnd some more.",
+			headings: "",
+			blocks:   1,
+		},
+		{
+			name:    "nesting",
+			content: "# Getting started\nintro\n## Installing Go\n## Hello, world\n### Running it\n# Next steps",
+			headings: "Getting started #getting-started\n" +
+				"  Installing Go #installing-go\n" +
+				"  Hello, world #hello-world\n" +
+				"    Running it #running-it\n" +
+				"Next steps #next-steps\n",
+			blocks: 6,
+		},
+		{
+			name:    "skipped level",
+			content: "### Deep\n# Top\n## Under",
+			headings: "Deep #deep\n" +
+				"Top #top\n" +
+				"  Under #under\n",
+			blocks: 3,
+		},
+		{
+			name:    "duplicate ids",
+			content: "# Setup\n# Setup\n# setup!",
+			headings: "Setup #setup\n" +
+				"Setup #setup-2\n" +
+				"setup! #setup-3\n",
+			blocks: 3,
+		},
+		{
+			name:     "reserved ids",
+			content:  "# Comments",
+			reserved: []string{"comments"},
+			headings: "Comments #comments-2\n",
+			blocks:   1,
+		},
+		{
+			name:     "no letters",
+			content:  "# !!!\n# ???",
+			headings: "!!! #section\n??? #section-2\n",
+			blocks:   2,
+		},
+		{
+			name:     "code fences",
+			content:  "# Script\n```\n# a comment\n```\n~~~sh\n## not a heading\n~~~\n## After",
+			headings: "Script #script\n  After #after\n",
+			blocks:   3,
+		},
+		{
+			name:     "closing hashes",
+			content:  "## Install ##\n# Learning C#\n# F# and C# #",
+			headings: "Install #install\nLearning C# #learning-c\nF# and C# #f-and-c\n",
+			blocks:   3,
+		},
+		{
+			name:     "not headings",
+			content:  "#hashtag\n####### seven\n    # indented",
+			headings: "",
+			blocks:   1,
+		},
+		{
+			name:     "Bengali",
+			content:  "# শুরু করা\r\ntext",
+			headings: "শুরু করা #শুরু-করা\n",
+			blocks:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Parse(tt.content, tt.reserved...)
+
+			var b strings.Builder
+			tree(o.Headings, 0, &b)
+			if got := b.String(); got != tt.headings {
+				t.Errorf("headings:\n%s\nwant:\n%s", got, tt.headings)
+			}
+
+			if len(o.Blocks) != tt.blocks {
+				t.Errorf("len(Blocks) = %d; want %d", len(o.Blocks), tt.blocks)
+			}
+		})
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	o := Parse("Intro\n\n# One\nfirst\n\n```\n# code\n```\n## Two\nsecond\n")
+
+	want := []string{"Intro", "# One", "first\n\n```\n# code\n```", "## Two", "second"}
+
+	if len(o.Blocks) != len(want) {
+		t.Fatalf("len(Blocks) = %d; want %d", len(o.Blocks), len(want))
+	}
+
+	for i, block := range o.Blocks {
+		got := block.Text
+		if block.Heading != nil {
+			got = strings.Repeat("#", block.Heading.Level) + " " + block.Heading.Text
+		}
+		if got != want[i] {
+			t.Errorf("Blocks[%d] = %q; want %q", i, got, want[i])
+		}
+	}
+}
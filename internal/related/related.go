@@ -0,0 +1,260 @@
+package related
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+	Related posts
+	=============
+		Two blogs are related when they use the same unusual words and share
+		tags. The score of a pair is
+
+			TextWeight × cosine(tf-idf of A, tf-idf of B) + TagWeight × jaccard(tags of A, tags of B)
+
+		tf-idf counts how often a word is in a blog (tf) and weighs it down
+		when many blogs use it (idf), so "the" counts for nothing and
+		"goroutine" for a lot. The cosine of the two word vectors is 1 for
+		blogs with the same words and 0 for blogs with none in common. The
+		jaccard index is the number of shared tags over the number of tags
+		the two have together, also between 0 and 1.
+
+		An Index is built from every blog at once, because the idf of a word
+		depends on all of them. Building it is quick for the number of blogs
+		a site like ours has, so it's simply built again for every update.
+*/
+
+// Doc is a blog as the index sees it.
+type Doc struct {
+	ID    int
+	Title string
+	Text  string
+	Tags  []string
+}
+
+// Match is a related blog and its score.
+type Match struct {
+	ID    int
+	Score float64
+}
+
+// titleWeight is how many times the words of the title count, they say more
+// about what a blog is about than the words of the text.
+const titleWeight = 3
+
+// MinScore is the lowest score a related blog can have. Pairs under it only
+// share a common word or two.
+const MinScore = 0.05
+
+// Index holds the tf-idf vectors and the tags of a set of blogs.
+type Index struct {
+	TextWeight float64
+	TagWeight  float64
+
+	vectors map[int]map[string]float64
+	tags    map[int]map[string]bool
+	ids     []int
+}
+
+// NewIndex() builds the index of docs. The text and the tags count half each.
+func NewIndex(docs []Doc) *Index {
+	ix := &Index{
+		TextWeight: 0.5,
+		TagWeight:  0.5,
+		vectors:    map[int]map[string]float64{},
+		tags:       map[int]map[string]bool{},
+	}
+
+	counts := map[int]map[string]int{}
+	df := map[string]int{}
+
+	for _, doc := range docs {
+		tf := map[string]int{}
+		for _, w := range Words(doc.Title) {
+			tf[w] += titleWeight
+		}
+		for _, w := range Words(doc.Text) {
+			tf[w]++
+		}
+		for w := range tf {
+			df[w]++
+		}
+		counts[doc.ID] = tf
+
+		tags := map[string]bool{}
+		for _, t := range doc.Tags {
+			tags[t] = true
+		}
+		ix.tags[doc.ID] = tags
+
+		ix.ids = append(ix.ids, doc.ID)
+	}
+
+	n := float64(len(docs))
+
+	for id, tf := range counts {
+		vector := map[string]float64{}
+		var norm float64
+
+		for w, c := range tf {
+			// The +1 keeps words which every blog uses at a small
+			// weight instead of none, so two blogs of a site with
+			// only two blogs can still be related.
+			weight := (1 + math.Log(float64(c))) * math.Log(1+n/float64(df[w]))
+			vector[w] = weight
+			norm += weight * weight
+		}
+
+		// Normalize the vector to length 1, so the cosine of two vectors
+		// is just their dot product.
+		norm = math.Sqrt(norm)
+		for w := range vector {
+			vector[w] /= norm
+		}
+
+		ix.vectors[id] = vector
+	}
+
+	return ix
+}
+
+// Score() returns the score of the pair of blogs a and b.
+func (ix *Index) Score(a, b int) float64 {
+	va, vb := ix.vectors[a], ix.vectors[b]
+	if len(vb) < len(va) {
+		va, vb = vb, va
+	}
+
+	var cosine float64
+	for w, x := range va {
+		cosine += x * vb[w]
+	}
+
+	var jaccard float64
+	ta, tb := ix.tags[a], ix.tags[b]
+	if len(ta) > 0 && len(tb) > 0 {
+		shared := 0
+		for t := range ta {
+			if tb[t] {
+				shared++
+			}
+		}
+		jaccard = float64(shared) / float64(len(ta)+len(tb)-shared)
+	}
+
+	return ix.TextWeight*cosine + ix.TagWeight*jaccard
+}
+
+// Similar() returns the limit blogs which are most related to the blog id,
+// best first.
+func (ix *Index) Similar(id, limit int) []Match {
+	var matches []Match
+
+	for _, other := range ix.ids {
+		if other == id {
+			continue
+		}
+		if score := ix.Score(id, other); score >= MinScore {
+			matches = append(matches, Match{ID: other, Score: score})
+		}
+	}
+
+	return top(matches, limit)
+}
+
+// Update() works out what changes when the blog id was added or changed. It
+// returns the lists of related blogs which are different from the current
+// ones: the list of the blog itself, and the lists of the other blogs which it
+// now belongs in (or fell out of).
+func (ix *Index) Update(id int, current map[int][]Match, limit int) map[int][]Match {
+	changed := map[int][]Match{id: ix.Similar(id, limit)}
+
+	for _, other := range ix.ids {
+		if other == id {
+			continue
+		}
+
+		list := current[other]
+
+		// Take the old score of the blog out of the list first, it may
+		// have changed.
+		var kept []Match
+		was := false
+		for _, m := range list {
+			if m.ID == id {
+				was = true
+				continue
+			}
+			kept = append(kept, m)
+		}
+
+		score := ix.Score(other, id)
+		if score >= MinScore {
+			kept = append(kept, Match{ID: id, Score: score})
+		}
+		kept = top(kept, limit)
+
+		now := false
+		for _, m := range kept {
+			if m.ID == id {
+				now = true
+			}
+		}
+
+		if was || now {
+			changed[other] = kept
+		}
+	}
+
+	return changed
+}
+
+// top() sorts matches best first and returns the first limit of them. Equal
+// scores are ordered by ID, newest first, so the order doesn't change from one
+// run to the next.
+func top(matches []Match, limit int) []Match {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID > matches[j].ID
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// stopWords are common English words which say nothing about what a blog is
+// about. idf weighs them down anyway, but on a site with few blogs it can't
+// tell them from real words yet.
+var stopWords = map[string]bool{
+	"and": true, "are": true, "but": true, "can": true, "for": true,
+	"from": true, "had": true, "has": true, "have": true, "her": true,
+	"his": true, "how": true, "its": true, "not": true, "our": true,
+	"out": true, "she": true, "that": true, "the": true, "their": true,
+	"them": true, "then": true, "there": true, "they": true, "this": true,
+	"was": true, "were": true, "what": true, "when": true, "which": true,
+	"who": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+// Words() splits text into lower case words, leaving out the stop words and
+// words of fewer than three letters.
+func Words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+
+	words := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) < 3 || stopWords[f] {
+			continue
+		}
+		words = append(words, f)
+	}
+	return words
+}
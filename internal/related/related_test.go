@@ -0,0 +1,128 @@
+package related
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testDocs are two blogs about concurrency in Go, one about Go web servers and
+// two about bread.
+var testDocs = []Doc{
+	{ID: 1, Title: "Goroutines and channels", Text: "A goroutine sends values on a channel, and another goroutine receives them.", Tags: []string{"go", "concurrency"}},
+	{ID: 2, Title: "Select statements", Text: "Select waits on many channel operations, like a goroutine blocked on a channel.", Tags: []string{"go", "concurrency"}},
+	{ID: 3, Title: "Baking bread", Text: "Flour, water, yeast and salt, then the oven.", Tags: []string{"cooking"}},
+	{ID: 4, Title: "Writing web servers", Text: "An http handler answers requests, a router picks the handler.", Tags: []string{"go", "web"}},
+	{ID: 5, Title: "Sourdough bread", Text: "A sourdough starter replaces the yeast of the bread.", Tags: []string{"cooking"}},
+}
+
+// ids() returns the IDs of matches, in order.
+func ids(matches []Match) []int {
+	ids := []int{}
+	for _, m := range matches {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestSimilar(t *testing.T) {
+	ix := NewIndex(testDocs)
+
+	tests := []struct {
+		name  string
+		id    int
+		limit int
+		want  []int
+	}{
+		{name: "words and tags", id: 1, limit: 10, want: []int{2, 4}},
+		{name: "limit", id: 1, limit: 1, want: []int{2}},
+		{name: "equal scores newest first", id: 4, limit: 10, want: []int{2, 1}},
+		{name: "words only", id: 3, limit: 10, want: []int{5}},
+		{name: "unknown blog", id: 9, limit: 10, want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := ix.Similar(tt.id, tt.limit)
+
+			if got := ids(matches); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Similar(%d, %d) = %v; want %v", tt.id, tt.limit, got, tt.want)
+			}
+
+			for _, m := range matches {
+				if m.Score < MinScore || m.Score > 1+1e-9 {
+					t.Errorf("score of %d = %f; want between %f and 1", m.ID, m.Score, MinScore)
+				}
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	ix := NewIndex(testDocs)
+
+	if a, b := ix.Score(1, 2), ix.Score(2, 1); a != b {
+		t.Errorf("Score(1, 2) = %f and Score(2, 1) = %f; want the same", a, b)
+	}
+	if s := ix.Score(1, 3); s != 0 {
+		t.Errorf("Score(1, 3) = %f; want 0", s)
+	}
+	if s := ix.Score(1, 1); s < 0.999 || s > 1.001 {
+		t.Errorf("Score(1, 1) = %f; want 1", s)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ix := NewIndex(testDocs)
+
+	tests := []struct {
+		name    string
+		id      int
+		current map[int][]int
+		limit   int
+		want    map[int][]int
+	}{
+		{
+			name:    "new blog",
+			id:      5,
+			current: map[int][]int{1: {2, 4}, 2: {1, 4}, 4: {2, 1}},
+			limit:   3,
+			want:    map[int][]int{5: {3}, 3: {5}},
+		},
+		{
+			name:    "pushes another blog out",
+			id:      2,
+			current: map[int][]int{1: {4}, 4: {1}, 3: {5}, 5: {3}},
+			limit:   1,
+			want:    map[int][]int{2: {1}, 1: {2}, 4: {2}},
+		},
+		{
+			name:    "changed blog",
+			id:      4,
+			current: map[int][]int{1: {2, 4}, 2: {1, 4}, 3: {4, 5}, 5: {3}},
+			limit:   3,
+			want:    map[int][]int{4: {2, 1}, 1: {2, 4}, 2: {1, 4}, 3: {5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The lists of current only need the IDs, the scores are
+			// worked out again.
+			current := map[int][]Match{}
+			for id, list := range tt.current {
+				for _, other := range list {
+					current[id] = append(current[id], Match{ID: other, Score: ix.Score(id, other)})
+				}
+			}
+
+			got := map[int][]int{}
+			for id, matches := range ix.Update(tt.id, current, tt.limit) {
+				got[id] = ids(matches)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Update(%d) = %v; want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package spam
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+/*
+	Bayesian classifier
+	===================
+		Bayes learns the words of spam from the moderators. Every comment a
+		moderator approves or marks as spam is split into words, and the
+		Corpus counts in how many spam and how many good (ham) texts each
+		word was seen.
+
+		To score a new text we add up, for each of its words, how much more
+		often the word shows up in spam than in ham (the log of the ratio,
+		so a hundred words don't overflow). That gives the probability p
+		that the text is spam, and the score goes from -Weight (p = 0) to
+		+Weight (p = 1).
+
+		Until the moderators have made MinDocs decisions of each kind the
+		counts say little, so Bayes stays quiet.
+*/
+
+// TokenCount is how many spam and ham texts a word was seen in.
+type TokenCount struct {
+	Spam int
+	Ham  int
+}
+
+// Corpus stores what the classifier learned.
+type Corpus interface {
+	// Counts returns the counts of the tokens it has seen, and the number
+	// of spam and ham texts it learned from.
+	Counts(tokens []string) (counts map[string]TokenCount, spamDocs, hamDocs int, err error)
+	// Learn adds one text, split into tokens, to the counts.
+	Learn(tokens []string, isSpam bool) error
+}
+
+// maxTokens is the number of words of a text Bayes looks at.
+const maxTokens = 200
+
+type Bayes struct {
+	Corpus  Corpus
+	Weight  float64
+	MinDocs int
+}
+
+func (b *Bayes) Score(s Submission) (float64, string, error) {
+	tokens := Tokens(s.Text)
+	if len(tokens) == 0 {
+		return 0, "", nil
+	}
+
+	counts, spamDocs, hamDocs, err := b.Corpus.Counts(tokens)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if spamDocs < b.MinDocs || hamDocs < b.MinDocs {
+		return 0, "", nil
+	}
+
+	// Start from how common spam is, then let every word move the odds.
+	// The +1 and +2 (Laplace smoothing) stop a word seen only in spam from
+	// making the odds infinite.
+	logOdds := math.Log(float64(spamDocs) / float64(hamDocs))
+	for _, t := range tokens {
+		c := counts[t]
+		pSpam := float64(c.Spam+1) / float64(spamDocs+2)
+		pHam := float64(c.Ham+1) / float64(hamDocs+2)
+		logOdds += math.Log(pSpam / pHam)
+	}
+
+	p := 1 / (1 + math.Exp(-logOdds))
+
+	return (2*p - 1) * b.Weight, fmt.Sprintf("bayes spam probability %.2f", p), nil
+}
+
+func (b *Bayes) Train(s Submission, isSpam bool) error {
+	tokens := Tokens(s.Text)
+	if len(tokens) == 0 {
+		return nil
+	}
+	return b.Corpus.Learn(tokens, isSpam)
+}
+
+// Tokens() splits text into its distinct lower case words, in the order they
+// first appear. Very short and very long words are left out, they're mostly
+// noise.
+func Tokens(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+
+	seen := map[string]bool{}
+	tokens := []string{}
+
+	for _, f := range fields {
+		n := len([]rune(f))
+		if n < 2 || n > 40 || seen[f] {
+			continue
+		}
+		seen[f] = true
+		tokens = append(tokens, f)
+
+		if len(tokens) == maxTokens {
+			break
+		}
+	}
+
+	return tokens
+}
@@ -0,0 +1,51 @@
+package spam
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Blocklist scores every blocked term found in the text. The terms are
+// matched without caring about case, anywhere in the text, so "casino"
+// also blocks "casinos".
+type Blocklist struct {
+	Terms  []string
+	Weight float64
+}
+
+func (b Blocklist) Score(s Submission) (float64, string, error) {
+	text := strings.ToLower(s.Text)
+
+	var found []string
+	for _, term := range b.Terms {
+		if strings.Contains(text, term) {
+			found = append(found, term)
+		}
+	}
+
+	if len(found) == 0 {
+		return 0, "", nil
+	}
+	return float64(len(found)) * b.Weight, "blocked terms: " + strings.Join(found, ", "), nil
+}
+
+// ParseBlocklist() reads a blocklist with one term per line. Blank lines and
+// lines starting with # are skipped.
+func ParseBlocklist(r io.Reader) ([]string, error) {
+	var terms []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms = append(terms, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
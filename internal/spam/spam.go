@@ -0,0 +1,234 @@
+package spam
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Spam filtering
+	==============
+		Every form anybody can send (comments, new blogs, translations) goes
+		through a Filter before it's saved. The Filter asks each of its
+		Checks for a score, adds them up, and the total decides:
+
+			score <  Approve          Approve, publish straight away
+			score >= Reject           Reject, it's spam
+			anything in between       Queue, let a moderator decide
+
+		A check can also take away from the score (the Bayes check does when
+		a text looks like the ones moderators approved before), so a good
+		comment can end up under the Approve threshold.
+
+		New checks only need a Score() method, see the Check interface.
+*/
+
+// Submission is what a visitor sent in a form, as the checks see it.
+type Submission struct {
+	// Text is all the text the visitor wrote, like the name and the comment.
+	Text string
+	// Honeypot is the value of the hidden field humans never fill in.
+	Honeypot string
+	// Stamp is the form stamp from NewStamp(), which says when the form was
+	// shown.
+	Stamp string
+}
+
+// Verdict is what should happen to a submission.
+type Verdict int
+
+const (
+	Approve Verdict = iota
+	Queue
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Approve:
+		return "approve"
+	case Queue:
+		return "queue"
+	default:
+		return "reject"
+	}
+}
+
+// Check is one step of the filter. Score() returns how spammy the submission
+// looks to the check, and why, or 0 and "" when it has nothing against it.
+type Check interface {
+	Score(s Submission) (float64, string, error)
+}
+
+// Trainer is a Check which learns from the decisions of the moderators.
+type Trainer interface {
+	Train(s Submission, isSpam bool) error
+}
+
+// Result is the outcome of running a Filter on a submission.
+type Result struct {
+	Score   float64
+	Verdict Verdict
+	// Reasons are the explanations of the checks which scored, for the logs.
+	Reasons []string
+}
+
+// Filter runs its checks on a submission and turns the total score into a
+// Verdict with the Approve and Reject thresholds.
+type Filter struct {
+	Checks  []Check
+	Approve float64
+	Reject  float64
+}
+
+// Check() scores s with every check of the filter. When a check fails, its
+// error is returned together with the result of the checks that did work.
+func (f *Filter) Check(s Submission) (Result, error) {
+	var result Result
+	var firstErr error
+
+	for _, c := range f.Checks {
+		score, reason, err := c.Score(s)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		result.Score += score
+		if reason != "" && score != 0 {
+			result.Reasons = append(result.Reasons, fmt.Sprintf("%s (%+.1f)", reason, score))
+		}
+	}
+
+	switch {
+	case result.Score >= f.Reject:
+		result.Verdict = Reject
+	case result.Score < f.Approve:
+		result.Verdict = Approve
+	default:
+		result.Verdict = Queue
+	}
+
+	return result, firstErr
+}
+
+// Train() teaches every check which learns (see Trainer) that s was spam, or
+// that it wasn't.
+func (f *Filter) Train(s Submission, isSpam bool) error {
+	for _, c := range f.Checks {
+		if t, ok := c.(Trainer); ok {
+			if err := t.Train(s, isSpam); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Honeypot scores submissions which filled in the honeypot field. It's hidden
+// from people, but bots fill in every field they find.
+type Honeypot struct {
+	Weight float64
+}
+
+func (h Honeypot) Score(s Submission) (float64, string, error) {
+	if s.Honeypot != "" {
+		return h.Weight, "honeypot filled in", nil
+	}
+	return 0, "", nil
+}
+
+/*
+	Form stamps
+	===========
+		A person needs a few seconds to fill in a form, a bot doesn't. The
+		forms carry a stamp with the time they were shown, signed with HMAC
+		so a bot can't make one up:
+
+			1718000000.<signature>
+
+		A missing or forged stamp scores the same as a form sent too fast.
+		So does a stamp older than Max, otherwise a bot could fetch one
+		stamp and send it with every submission for ever.
+*/
+
+// NewStamp() returns the form stamp for a form shown at t.
+func NewStamp(key []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return ts + "." + sign(key, ts)
+}
+
+// StampTime() returns the time in a form stamp, if the stamp is genuine.
+func StampTime(key []byte, stamp string) (time.Time, bool) {
+	ts, sig, ok := strings.Cut(stamp, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(key, ts))) {
+		return time.Time{}, false
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
+
+func sign(key []byte, s string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// MinTime scores submissions sent sooner than Min or later than Max after the
+// form was shown, or without a genuine form stamp.
+type MinTime struct {
+	Key    []byte
+	Min    time.Duration
+	Max    time.Duration // 0 for no limit
+	Weight float64
+	// Now returns the current time. When it's nil time.Now() is used.
+	Now func() time.Time
+}
+
+func (m MinTime) Score(s Submission) (float64, string, error) {
+	shown, ok := StampTime(m.Key, s.Stamp)
+	if !ok {
+		return m.Weight, "no valid form stamp", nil
+	}
+
+	now := time.Now()
+	if m.Now != nil {
+		now = m.Now()
+	}
+
+	elapsed := now.Sub(shown)
+	if elapsed < m.Min || (m.Max > 0 && elapsed > m.Max) {
+		return m.Weight, fmt.Sprintf("sent %s after the form was shown", elapsed.Round(time.Second)), nil
+	}
+	return 0, "", nil
+}
+
+// Links scores every link in the text after the first Free ones.
+type Links struct {
+	Free   int
+	Weight float64
+}
+
+func (l Links) Score(s Submission) (float64, string, error) {
+	text := strings.ToLower(s.Text)
+
+	n := strings.Count(text, "http://") + strings.Count(text, "https://") + strings.Count(text, "<a ")
+	// "www." without a scheme in front of it is a link too.
+	n += strings.Count(text, "www.") - strings.Count(text, "://www.")
+
+	if n <= l.Free {
+		return 0, "", nil
+	}
+	return float64(n-l.Free) * l.Weight, fmt.Sprintf("%d links", n), nil
+}
@@ -0,0 +1,488 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	S3
+	==
+		S3 keeps the files in a bucket of an S3-compatible object store:
+		Amazon S3 itself, or MinIO, Ceph, R2 and the like. It speaks the S3
+		REST API directly and signs the requests with AWS Signature Version
+		4, so we don't need an SDK for the five calls we make.
+
+		A local MinIO works as a stand-in while developing:
+
+			docker run -p 9000:9000 -e MINIO_ROOT_USER=minio -e MINIO_ROOT_PASSWORD=minio123 minio/minio server /data
+
+			-storage=s3 -s3-endpoint="http://localhost:9000" -s3-bucket="storybook" \
+				-s3-access-key="minio" -s3-secret-key="minio123"
+
+		Every key is stored under Prefix, so one bucket can hold the files of
+		several sites (or the media and the static files of one site).
+
+		Note:
+			Presigned URLs let a browser read or write one key of the bucket
+			for a while without having the keys. Uploads with them need a
+			CORS rule on the bucket which allows PUT from the site.
+*/
+
+// S3 is a Storage which keeps the files in a bucket of an S3-compatible object
+// store.
+type S3 struct {
+	// Endpoint is the address of the service, like
+	// "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// PathStyle puts the bucket in the path of the URLs (host/bucket/key)
+	// instead of the host name (bucket.host/key). MinIO needs it.
+	PathStyle bool
+	// CacheControl is sent with every Put(), so the store serves the files
+	// with it.
+	CacheControl string
+	// Client is the HTTP client for the requests, http.DefaultClient when
+	// it's nil.
+	Client *http.Client
+	// Now returns the current time. When it's nil time.Now() is used.
+	Now func() time.Time
+}
+
+// unsignedPayload is the payload hash for requests whose body isn't hashed.
+// We stream uploads, so hashing them first would mean reading them twice.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3Error is the XML body of an error response.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// Origin() returns the scheme and host the objects are served from, like
+// "https://storybook.s3.amazonaws.com".
+func (s *S3) Origin() string {
+	u := s.url("", nil)
+	return u.Scheme + "://" + u.Host
+}
+
+// url() returns the URL of the object key, or of the bucket when key is "".
+func (s *S3) url(key string, query url.Values) *url.URL {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Host == "" {
+		u = &url.URL{Scheme: "https", Host: "s3." + s.Region + ".amazonaws.com"}
+	}
+
+	path := "/"
+	if key != "" {
+		path += s.prefix() + key
+	}
+	if s.PathStyle {
+		path = "/" + s.Bucket + path
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+	u.RawQuery = canonicalQuery(query)
+	return u
+}
+
+// prefix() returns the Prefix with one slash at the end, or "".
+func (s *S3) prefix() string {
+	p := strings.Trim(s.Prefix, "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+// now() returns the time requests are signed with, in UTC.
+func (s *S3) now() time.Time {
+	if s.Now != nil {
+		return s.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (s *S3) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+// do() signs and sends a request for key. A response with an error status is
+// turned into an error, and NoSuchKey (or a 404 to a HEAD) into ErrNotExist.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	// The http package takes a body of length 0 for one of unknown length,
+	// and sends it chunked, which S3 doesn't accept.
+	if body != nil && size == 0 {
+		body = http.NoBody
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.url(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil && body != http.NoBody {
+		req.ContentLength = size
+	}
+
+	s.sign(req, s.now())
+
+	res, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	var e s3Error
+	xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&e)
+
+	if e.Code == "NoSuchKey" || (res.StatusCode == http.StatusNotFound && e.Code == "") {
+		return nil, ErrNotExist
+	}
+	if e.Code == "" {
+		e.Code = res.Status
+	}
+	return nil, fmt.Errorf("storage: s3 %s %q: %s %s", method, key, e.Code, e.Message)
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if s.CacheControl != "" {
+		header.Set("Cache-Control", s.CacheControl)
+	}
+
+	// The http package closes a body it was given, which isn't ours to
+	// close, so it only gets a plain io.Reader.
+	res, err := s.do(ctx, http.MethodPut, key, nil, io.NopCloser(r), size, header)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, ErrNotExist
+	}
+
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	modified, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+
+	return &Object{
+		Body:        res.Body,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+		Modified:    modified,
+	}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrNotExist
+	}
+
+	// S3 answers the delete of a missing key with success too, so ask for
+	// it first to return ErrNotExist like the other stores.
+	res, err := s.do(ctx, http.MethodHead, key, nil, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	res, err = s.do(ctx, http.MethodDelete, key, nil, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// listResult is the part of a ListObjectsV2 response we use.
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) Walk(ctx context.Context, fn func(key string) error) error {
+	prefix := s.prefix()
+	token := ""
+
+	// A listing returns at most 1000 keys, and a token to ask for the next
+	// ones.
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := s.do(ctx, http.MethodGet, "", query, nil, 0, nil)
+		if err != nil {
+			return err
+		}
+
+		var list listResult
+		err = xml.NewDecoder(res.Body).Decode(&list)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, c := range list.Contents {
+			key := strings.TrimPrefix(c.Key, prefix)
+			// Keys made by other tools can be anything, skip the ones
+			// we'd refuse ourselves.
+			if !ValidKey(key) {
+				continue
+			}
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return nil
+		}
+		token = list.NextContinuationToken
+	}
+}
+
+// PresignGet() returns a URL which anyone can download the file of key from,
+// until it expires.
+func (s *S3) PresignGet(key string, expires time.Duration) (string, error) {
+	return s.presign(http.MethodGet, key, expires)
+}
+
+// PresignPut() returns a URL which anyone can upload the file of key to with a
+// PUT request, until it expires.
+func (s *S3) PresignPut(key string, expires time.Duration) (string, error) {
+	return s.presign(http.MethodPut, key, expires)
+}
+
+func (s *S3) presign(method, key string, expires time.Duration) (string, error) {
+	if !ValidKey(key) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	// S3 refuses presigned URLs which are valid for more than a week.
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", fmt.Errorf("storage: invalid expiry %s", expires)
+	}
+
+	now := s.now()
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+
+	u := s.url(key, query)
+	header := http.Header{"Host": {u.Host}}
+
+	signature := s.signature(now, method, u, header, unsignedPayload)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+/*
+	Signature Version 4
+	===================
+		Every request is signed with the secret key: we write the request
+		down in a fixed form (the canonical request), hash it, and sign the
+		hash with a key derived from the secret key, the date, the region
+		and the service. The service does the same and compares.
+
+		The signature goes into the Authorization header, or for a presigned
+		URL into the query string.
+*/
+
+// sign() adds the Authorization header to req.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	header := req.Header.Clone()
+	header.Set("Host", req.URL.Host)
+
+	signature := s.signature(now, req.Method, req.URL, header, unsignedPayload)
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, s.scope(now), signedHeaders(header), signature))
+}
+
+// s3Service is the name of the service in the signatures of S3 requests.
+const s3Service = "s3"
+
+// scope() returns the credential scope of a signature made at t.
+func (s *S3) scope(t time.Time) string {
+	return credentialScope(t, s.Region, s3Service)
+}
+
+// signature() returns the signature of a request, given all the headers that
+// are signed.
+func (s *S3) signature(t time.Time, method string, u *url.URL, header http.Header, payloadHash string) string {
+	request := canonicalRequest(method, u, header, payloadHash)
+	key := signingKey(s.SecretKey, t, s.Region, s3Service)
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign(t, s.scope(t), request)))
+}
+
+// credentialScope() returns the date, region and service a signature made at
+// t is valid for.
+func credentialScope(t time.Time, region, service string) string {
+	return t.Format("20060102") + "/" + region + "/" + service + "/aws4_request"
+}
+
+// canonicalRequest() writes the request down in the fixed form which is
+// hashed and signed. The query of u must already be in canonicalQuery() form.
+func canonicalRequest(method string, u *url.URL, header http.Header, payloadHash string) string {
+	return strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		u.RawQuery,
+		canonicalHeaders(header),
+		signedHeaders(header),
+		payloadHash,
+	}, "\n")
+}
+
+// stringToSign() returns what the signing key signs: the time, the scope and
+// the hash of the canonical request.
+func stringToSign(t time.Time, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	return "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+}
+
+// signingKey() derives the key of one day, region and service from the secret
+// key.
+func signingKey(secret string, t time.Time, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), t.Format("20060102"))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalHeaders() returns the headers as lower case name:value lines,
+// sorted by name.
+func canonicalHeaders(header http.Header) string {
+	var b strings.Builder
+	for _, name := range sortedHeaderNames(header) {
+		var values []string
+		for _, v := range header.Values(name) {
+			values = append(values, strings.Join(strings.Fields(v), " "))
+		}
+		b.WriteString(strings.ToLower(name) + ":" + strings.Join(values, ",") + "\n")
+	}
+	return b.String()
+}
+
+// signedHeaders() returns the lower case names of the headers, sorted and
+// separated by semicolons.
+func signedHeaders(header http.Header) string {
+	names := sortedHeaderNames(header)
+	for i := range names {
+		names[i] = strings.ToLower(names[i])
+	}
+	return strings.Join(names, ";")
+}
+
+func sortedHeaderNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names
+}
+
+// canonicalQuery() returns the query string sorted by name, and the values of
+// a name by value, with every name and value encoded the way the signature
+// needs.
+func canonicalQuery(query url.Values) string {
+	var pairs [][2]string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{uriEncode(name, true), uriEncode(value, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+
+	parts := make([]string, len(pairs))
+	for i, p := range pairs {
+		parts[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode() percent-encodes everything but the unreserved characters of
+// RFC 3986, and the slashes unless encodeSlash is set. url.PathEscape() and
+// url.QueryEscape() both leave characters alone that the signature needs
+// encoded.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
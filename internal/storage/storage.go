@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+/*
+	Storage
+	=======
+		Uploaded files are kept in a Storage. It's an interface so the files
+		can live anywhere: Disk keeps them in a folder on the server, S3 in
+		a bucket of an S3-compatible object store, and other stores only
+		need the same few methods.
+
+		Files are named by a key, a slash separated path like
+		"3f9a.../w640.jpg". Keys never start with a slash and never contain
+		"..", the stores can use them as paths as they are.
+*/
+
+// ErrNotExist is returned by Get() and Delete() when there is no file with
+// the key.
+var ErrNotExist = errors.New("storage: file does not exist")
+
+// Object is a file read from a Storage. The caller must close the Body.
+type Object struct {
+	Body        io.ReadCloser
+	Size        int64
+	ContentType string
+	Modified    time.Time
+}
+
+type Storage interface {
+	// Put stores the size bytes of r under key, replacing any file which
+	// was there.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the file stored under key.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the file stored under key.
+	Delete(ctx context.Context, key string) error
+	// Walk calls fn with the key of every stored file.
+	Walk(ctx context.Context, fn func(key string) error) error
+}
+
+// Presigner is implemented by stores which can hand out URLs for reading or
+// writing a file straight from the store, without going through us. S3 is
+// one, Disk isn't.
+type Presigner interface {
+	// PresignGet returns a URL the file of key can be downloaded from
+	// until it expires.
+	PresignGet(key string, expires time.Duration) (string, error)
+	// PresignPut returns a URL the file of key can be uploaded to with a
+	// PUT request until it expires.
+	PresignPut(key string, expires time.Duration) (string, error)
+}
+
+// ValidKey() reports whether key is a key a Storage accepts. Backslashes are
+// refused too, Windows would take them for path separators.
+func ValidKey(key string) bool {
+	if key == "" || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
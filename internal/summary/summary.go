@@ -0,0 +1,154 @@
+package summary
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	Summaries
+	=========
+		When a blog is written we count its words, work out how long it
+		takes to read, and cut an excerpt from the start of it for the home
+		page and the share previews. They're saved with the blog, so the
+		pages which list blogs don't have to go through every content.
+
+		People write their blogs in Markdown, but the pages show the plain
+		text, so the markup is stripped first:
+
+			# Heading              Heading
+			**bold**, _italic_     bold, italic
+			[a link](https://…)    a link
+			![an image](x.png)     (left out)
+			`code`                 code
+
+		Headings and code blocks count as words, but aren't in the excerpt:
+		it should start with the first real sentence, and the code of a
+		blog doesn't read well on its own.
+*/
+
+// WordsPerMinute is how fast people read, for the reading time.
+const WordsPerMinute = 200
+
+// ExcerptLength is the most characters an excerpt has. It's about what search
+// engines show of a meta description.
+const ExcerptLength = 160
+
+// Summary is what's known about a blog without reading it.
+type Summary struct {
+	Words       int
+	ReadingTime int // in minutes, at least 1
+	Excerpt     string
+}
+
+var (
+	images = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	links  = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	tags   = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	// A _ only marks emphasis at the edge of a word, snake_case stays.
+	emphasis = regexp.MustCompile("[*`~]|\\b_+|_+\\b")
+
+	headings = regexp.MustCompile(`^#{1,6}\s+`)
+	quotes   = regexp.MustCompile(`^(>\s?)+`)
+	bullets  = regexp.MustCompile(`^([-*+]|\d+[.)])\s+`)
+	rules    = regexp.MustCompile(`^([-*_]\s*){3,}$`)
+)
+
+// Of() returns the summary of the content of a blog.
+func Of(content string) Summary {
+	var words int
+	var prose []string
+	code := false
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+
+		// ``` and ~~~ start and end code blocks.
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			code = !code
+			continue
+		}
+		if code {
+			words += len(strings.Fields(line))
+			continue
+		}
+
+		if rules.MatchString(line) {
+			continue
+		}
+
+		heading := headings.MatchString(line)
+
+		line = stripLine(line)
+		words += len(strings.Fields(line))
+
+		if !heading {
+			prose = append(prose, line)
+		}
+	}
+
+	minutes := (words + WordsPerMinute - 1) / WordsPerMinute
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	return Summary{
+		Words:       words,
+		ReadingTime: minutes,
+		Excerpt:     Excerpt(strings.Join(prose, " "), ExcerptLength),
+	}
+}
+
+// stripLine() takes the Markdown out of one line of text.
+func stripLine(line string) string {
+	line = headings.ReplaceAllString(line, "")
+	line = quotes.ReplaceAllString(line, "")
+	line = bullets.ReplaceAllString(line, "")
+	line = images.ReplaceAllString(line, "")
+	line = links.ReplaceAllString(line, "$1")
+	line = tags.ReplaceAllString(line, "")
+	line = emphasis.ReplaceAllString(line, "")
+	return line
+}
+
+// Excerpt() returns the whole sentences from the start of text which fit in n
+// characters. When even the first sentence is longer, it's cut after the last
+// word which fits, with an ellipsis.
+func Excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+
+	// The end of the last sentence which fits: a full stop, question or
+	// exclamation mark (or the Bengali daari) followed by a space.
+	end := 0
+	count := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		count++
+		if count > n {
+			break
+		}
+		if isSentenceEnd(r) && i+1 < len(runes) && unicode.IsSpace(runes[i+1]) {
+			end = i + 1
+		}
+	}
+
+	if end > 0 {
+		return string(runes[:end])
+	}
+
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '।'
+}
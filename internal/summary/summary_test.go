@@ -0,0 +1,118 @@
+package summary
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		n    int
+		want string
+	}{
+		{
+			name: "short",
+			text: "A short blog.",
+			n:    160,
+			want: "A short blog.",
+		},
+		{
+			name: "spaces",
+			text: "  Lots of\n\nspace   here. ",
+			n:    160,
+			want: "Lots of space here.",
+		},
+		{
+			name: "whole sentences",
+			text: "First one. Second one! Third one is too long for it.",
+			n:    25,
+			want: "First one. Second one!",
+		},
+		{
+			name: "no full stop in a word",
+			text: "Go 1.24 is out. It came today and brings a lot.",
+			n:    20,
+			want: "Go 1.24 is out.",
+		},
+		{
+			name: "long first sentence",
+			text: "This first sentence goes on and on, and doesn't end soon enough",
+			n:    30,
+			want: "This first sentence goes on…",
+		},
+		{
+			name: "cut before a comma",
+			text: "One, two, three, four, five, six",
+			n:    13,
+			want: "One, two…",
+		},
+		{
+			name: "Bengali daari",
+			text: "আমি ভাত খাই। তুমি কী খাও? সে অনেক কিছু খায়।",
+			n:    30,
+			want: "আমি ভাত খাই। তুমি কী খাও?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Excerpt(tt.text, tt.n); got != tt.want {
+				t.Errorf("Excerpt(%q, %d) = %q; want %q", tt.text, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Summary
+	}{
+		{
+			name:    "empty",
+			content: "",
+			want:    Summary{Words: 0, ReadingTime: 1, Excerpt: ""},
+		},
+		{
+			name:    "markdown",
+			content: "# Hello\n\nThis is **bold**, _italic_ and [a link](https://example.com).\n![an image](x.png)",
+			want:    Summary{Words: 8, ReadingTime: 1, Excerpt: "This is bold, italic and a link."},
+		},
+		{
+			name:    "lists and quotes",
+			content: "> Quoted text.\n\n- one\n- two\n1. three\n\n---",
+			want:    Summary{Words: 5, ReadingTime: 1, Excerpt: "Quoted text. one two three"},
+		},
+		{
+			name:    "code blocks",
+			content: "Run it:\n\n```go\nfmt.Println(\"hi\")\n```\n\nDone.",
+			want:    Summary{Words: 4, ReadingTime: 1, Excerpt: "Run it: Done."},
+		},
+		{
+			name:    "snake_case",
+			content: "Call read_file and `go_build`.",
+			want:    Summary{Words: 4, ReadingTime: 1, Excerpt: "Call read_file and go_build."},
+		},
+		{
+			name:    "html",
+			content: "<p>Some <em>html</em> here.</p>",
+			want:    Summary{Words: 3, ReadingTime: 1, Excerpt: "Some html here."},
+		},
+		{
+			name:    "reading time",
+			content: strings.Repeat("word ", 401),
+			want:    Summary{Words: 401, ReadingTime: 3, Excerpt: strings.TrimSpace(strings.Repeat("word ", 32)) + "…"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Of(tt.content); got != tt.want {
+				t.Errorf("Of(%q) = %+v; want %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
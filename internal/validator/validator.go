@@ -1,12 +1,18 @@
 package validator
 
 import (
+	"regexp"
 	"strings"
 	"unicode/utf8"
 )
 
 type Validator struct {
 	FieldErrors map[string]string
+
+	// T translates the message keys given to AddFieldError() and CheckField()
+	// (like "validation.blank") into the user's language. When it's nil the
+	// keys are stored as they are.
+	T func(key string, args ...any) string
 }
 
 // Valid() returns true if the FieldErrors map doesn't contain any entries.
@@ -15,23 +21,27 @@ func (v *Validator) Valid() bool {
 }
 
 // AddFieldError() adds an error message to the FieldErrors map (so long as no
-// entry already exists for the given key).
-func (v *Validator) AddFieldError(key, massage string) {
+// entry already exists for the given key). The message is a translation key,
+// and args are the values for the placeholders in the translated message.
+func (v *Validator) AddFieldError(key, massage string, args ...any) {
 	// Note: We need to initialize the map first, if it isn't already initialized.
 	if v.FieldErrors == nil {
 		v.FieldErrors = make(map[string]string)
 	}
 
 	if _, exist := v.FieldErrors[key]; !exist {
+		if v.T != nil {
+			massage = v.T(massage, args...)
+		}
 		v.FieldErrors[key] = massage
 	}
 }
 
 // CheckField() adds an error message to the FieldErrors map only if a
 // validation check is not 'ok'.
-func (v *Validator) CheckField(ok bool, key, message string) {
+func (v *Validator) CheckField(ok bool, key, message string, args ...any) {
 	if !ok {
-		v.AddFieldError(key, message)
+		v.AddFieldError(key, message, args...)
 	}
 }
 
@@ -53,3 +63,13 @@ func PermittedInt(value int, permittedValues ...int) bool {
 	}
 	return true
 }
+
+// SlugRX is the pattern of a slug: lower case letters (of any alphabet, so
+// Bengali slugs work too) and digits, in words joined by single dashes.
+var SlugRX = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{M}\p{N}]+(?:-[\p{Ll}\p{Lo}\p{M}\p{N}]+)*$`)
+
+// Matches() returns true if a value matches a provided compiled regular
+// expression pattern.
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
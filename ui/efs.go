@@ -0,0 +1,19 @@
+package ui
+
+import "embed"
+
+/*
+	embed.FS
+	========
+		The comment directive below tells the Go compiler to store the files
+		in the html, static and locales folders inside the binary, in an embedded file
+		system referenced by the global variable Files. This way the binary
+		works from any directory, not just from the root of the repository.
+
+		Note:
+			The paths are relative to this file (ui/efs.go), so the files
+			are found at "html/base.html", "static/css/main.css" and so on.
+*/
+
+//go:embed "html" "static" "locales"
+var Files embed.FS
@@ -5,4 +5,152 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Send the browser's timezone to the server in the "tz" cookie, so dates are
+// shown in the visitor's own time. A timezone picked on the preferences page
+// is never overwritten, because then the cookie is already there. Timezone
+// names only use characters which are allowed in a cookie as they are.
+if (document.cookie.split("; ").every(function (c) { return c.indexOf("tz=") !== 0; })) {
+	try {
+		var zone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+		if (zone) {
+			document.cookie = "tz=" + zone + "; path=/; max-age=31536000; samesite=lax";
+		}
+	} catch (e) {}
+}
+
+// The reaction buttons under a blog work without JavaScript, as a form which
+// reloads the page. With it the clicks are sent in the background, and the
+// visitor's own reactions are highlighted (the page itself is the same for
+// everybody, so it can't show them).
+var reactions = document.querySelector("form.reactions");
+if (reactions && window.fetch) {
+	var showReactions = function (data) {
+		var buttons = reactions.querySelectorAll("button");
+		for (var i = 0; i < buttons.length; i++) {
+			var kind = buttons[i].value;
+			buttons[i].querySelector(".count").textContent = data.counts[kind] || 0;
+			buttons[i].setAttribute("aria-pressed", data.mine.indexOf(kind) !== -1 ? "true" : "false");
+		}
+	};
+
+	fetch(reactions.action, { headers: { "Accept": "application/json" }, credentials: "same-origin" })
+		.then(function (res) { return res.ok ? res.json() : null; })
+		.then(function (data) { if (data) showReactions(data); })
+		.catch(function () {});
+
+	reactions.addEventListener("click", function (e) {
+		var button = e.target.closest("button");
+		if (!button) return;
+		e.preventDefault();
+
+		fetch(reactions.action, {
+			method: "POST",
+			headers: { "Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded" },
+			credentials: "same-origin",
+			body: "reaction=" + encodeURIComponent(button.value)
+		})
+			.then(function (res) { return res.ok ? res.json() : null; })
+			.then(function (data) { if (data) showReactions(data); })
+			.catch(function () {});
+	});
+}
+
+// The blog pages are cached, so their comment forms come without a form stamp
+// (see spam.go). It's fetched when the visitor starts filling in a form, or
+// at the latest when the form is sent.
+if (window.fetch) {
+	Array.prototype.forEach.call(document.querySelectorAll("form"), function (form) {
+		var field = form.querySelector("input[name=stamp]");
+		if (!field || field.value) return;
+
+		var pending = null;
+		var getStamp = function () {
+			if (!pending) {
+				pending = fetch("/form-stamp", { credentials: "same-origin" })
+					.then(function (res) { return res.ok ? res.text() : ""; })
+					.then(function (stamp) { field.value = stamp; })
+					.catch(function () {});
+			}
+			return pending;
+		};
+
+		form.addEventListener("focusin", getStamp);
+		form.addEventListener("submit", function (e) {
+			if (field.value) return;
+			e.preventDefault();
+			getStamp().then(function () { form.submit(); });
+		});
+	});
+}
+
+// With S3 storage the images of the media library are uploaded straight into
+// the bucket, one at a time, and the server only fetches them from there to
+// make the resized copies. When the server says it can't hand out upload URLs
+// (with disk storage) the form is sent the normal way. The CSRF token of the
+// form goes along in a header.
+var library = document.querySelector("form.media-upload");
+if (library && window.fetch && window.Promise) {
+	var status = library.querySelector(".upload-status");
+	var fallback = new Error("no direct uploads");
+	var token = library.querySelector("input[name=csrf_token]").value;
+
+	var uploadDirect = function (file) {
+		return fetch("/media-library/uploads", {
+			method: "POST",
+			headers: { "Accept": "application/json", "X-CSRF-Token": token },
+			credentials: "same-origin"
+		})
+			.then(function (res) {
+				if (res.status === 404) throw fallback;
+				if (!res.ok) throw new Error(res.statusText);
+				return res.json();
+			})
+			.then(function (target) {
+				return fetch(target.url, { method: target.method, body: file }).then(function (res) {
+					if (!res.ok) throw new Error(res.statusText);
+					return target.key;
+				});
+			})
+			.then(function (key) {
+				return fetch("/media-library/uploads/complete", {
+					method: "POST",
+					headers: { "Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded", "X-CSRF-Token": token },
+					credentials: "same-origin",
+					body: "key=" + encodeURIComponent(key) + "&name=" + encodeURIComponent(file.name)
+				});
+			})
+			.then(function (res) {
+				return res.json().then(function (data) {
+					if (!res.ok) throw new Error(data.message || res.statusText);
+					return data;
+				});
+			});
+	};
+
+	library.addEventListener("submit", function (e) {
+		var files = library.querySelector("input[type=file]").files;
+		if (!files.length || library.getAttribute("data-direct") === "no") return;
+		e.preventDefault();
+
+		var done = Promise.resolve();
+		Array.prototype.forEach.call(files, function (file) {
+			done = done.then(function () {
+				if (status) status.textContent = file.name + "…";
+				return uploadDirect(file);
+			});
+		});
+
+		done
+			.then(function () { window.location.reload(); })
+			.catch(function (err) {
+				if (err === fallback) {
+					library.setAttribute("data-direct", "no");
+					library.submit();
+					return;
+				}
+				if (status) status.textContent = err.message;
+			});
+	});
+}